@@ -0,0 +1,56 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/openrfsense/node/sensor"
+)
+
+// Events waiting to be sent to a slow client, newer ones are dropped when full
+const eventsBuffer = 64
+
+// Time between comments sent to keep idle connections open and detect closed ones
+const eventsKeepAlive = 15 * time.Second
+
+// Streams sensor events (see sensor.Event) as Server-Sent Events until the client
+// closes the connection.
+func HandleEventsGet(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+	// Disables buffering in reverse proxies
+	ctx.Set("X-Accel-Buffering", "no")
+
+	events, unsubscribe := sensor.Events(eventsBuffer)
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		ticker := time.NewTicker(eventsKeepAlive)
+		defer ticker.Stop()
+
+		// Sent right away so that clients know the stream is open
+		_, _ = fmt.Fprint(w, "retry: 5000\n\n")
+		err := w.Flush()
+		for err == nil {
+			select {
+			case e := <-events:
+				data, jsonErr := json.Marshal(e)
+				if jsonErr != nil {
+					log.Error(jsonErr)
+					continue
+				}
+				_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			case <-ticker.C:
+				_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			err = w.Flush()
+		}
+	})
+
+	return nil
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"errors"
+
 	"github.com/openrfsense/node/config"
+	"github.com/openrfsense/node/sensor"
 	"github.com/openrfsense/node/system"
 
 	"github.com/gofiber/fiber/v2"
@@ -35,3 +38,29 @@ func HandleWifiPost(ctx *fiber.Ctx) error {
 
 	return ctx.SendStatus(fiber.StatusOK)
 }
+
+func HandleCampaignsGet(ctx *fiber.Ctx) error {
+	return ctx.JSON(sensor.History())
+}
+
+func HandleProfilesGet(ctx *fiber.Ctx) error {
+	return ctx.JSON(sensor.Profiles())
+}
+
+func HandleScanPost(ctx *fiber.Ctx) error {
+	req := sensor.ScanRequest{}
+	err := ctx.BodyParser(&req)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	res, err := sensor.Scan(req)
+	if errors.Is(err, sensor.ErrInvalidCampaign) || errors.Is(err, sensor.ErrUnknownProfile) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+	}
+
+	return ctx.JSON(res)
+}
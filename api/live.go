@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+
+	"github.com/openrfsense/node/sensor"
+)
+
+// Frames waiting to be sent to a slow client, newer ones are dropped when full
+const liveBuffer = 64
+
+// Type LiveMessage is sent to WebSocket clients during a live measurement.
+type LiveMessage struct {
+	// One of "frame", "result" (sent last) or "error"
+	Type string `json:"type"`
+
+	Frame  *sensor.Frame      `json:"frame,omitempty"`
+	Result *sensor.ScanResult `json:"result,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+// Only lets WebSocket upgrade requests through to the live endpoint.
+func RequireWebSocket(ctx *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.ErrUpgradeRequired
+	}
+	return ctx.Next()
+}
+
+// Runs a local PSD measurement described by the first message (a
+// sensor.ScanRequest) and streams each sweep over the requested range as a
+// LiveMessage, however the sensor splits it. The measurement is cancelled when
+// the client closes the connection.
+func HandleLive(conn *websocket.Conn) {
+	req := sensor.ScanRequest{}
+	err := conn.ReadJSON(&req)
+	if err != nil {
+		_ = conn.WriteJSON(LiveMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	// Clients are not expected to send anything else, reading only detects
+	// when the connection is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	frames := make(chan sensor.Frame, liveBuffer)
+	done := make(chan LiveMessage, 1)
+	go func() {
+		res, err := sensor.Live(ctx, req, func(f sensor.Frame) {
+			select {
+			case frames <- f:
+			default:
+			}
+		})
+		if err != nil {
+			done <- LiveMessage{Type: "error", Error: err.Error()}
+			return
+		}
+		done <- LiveMessage{Type: "result", Result: res}
+	}()
+
+	for {
+		select {
+		case f := <-frames:
+			err := conn.WriteJSON(LiveMessage{Type: "frame", Frame: &f})
+			if err != nil {
+				cancel()
+			}
+		case msg := <-done:
+			for len(frames) > 0 {
+				f := <-frames
+				_ = conn.WriteJSON(LiveMessage{Type: "frame", Frame: &f})
+			}
+			if msg.Type == "error" {
+				log.Warnf("live measurement failed: %s", msg.Error)
+			}
+			_ = conn.WriteJSON(msg)
+			_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/gofiber/websocket/v2"
 	"github.com/knadh/koanf"
 
 	"github.com/openrfsense/common/logging"
@@ -33,6 +34,11 @@ func Start(config *koanf.Koanf, prefix string, routerConfig ...fiber.Config) *fi
 		)
 		router.Post("/network/wifi", HandleWifiPost)
 		router.Post("/config", HandleConfigPost)
+		router.Get("/campaigns", HandleCampaignsGet)
+		router.Get("/profiles", HandleProfilesGet)
+		router.Post("/sensor/scan", HandleScanPost)
+		router.Get("/sensor/live", RequireWebSocket, websocket.New(HandleLive))
+		router.Get("/sensor/events", HandleEventsGet)
 	})
 
 	addr := fmt.Sprintf(":%d", config.MustInt("node.port"))
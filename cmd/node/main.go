@@ -15,6 +15,7 @@ import (
 	"github.com/openrfsense/node/config"
 	"github.com/openrfsense/node/nats"
 	"github.com/openrfsense/node/sensor"
+	"github.com/openrfsense/node/spool"
 	"github.com/openrfsense/node/stats"
 	"github.com/openrfsense/node/system"
 	"github.com/openrfsense/node/ui"
@@ -32,6 +33,9 @@ var (
 )
 
 func main() {
+	// Sensor processes are started through the node itself
+	sensor.RunLauncher()
+
 	configPath := pflag.StringP("config", "c", "/etc/openrfsense/config.yml", "path to yaml config file")
 	natsTokenPath := pflag.StringP("token", "t", "/etc/openrfsense/token.txt", "path to token file")
 	showVersion := pflag.BoolP("version", "v", false, "shows program version and build info")
@@ -52,6 +56,14 @@ func main() {
 
 	stats.Init(konfig)
 
+	if konfig.Bool("node.spool.enabled") {
+		log.Info("Starting measurement spool")
+		err = spool.Start(konfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	log.Info("Initializing sensor manager")
 	err = sensor.Init(konfig)
 	if err != nil {
@@ -84,5 +96,6 @@ func main() {
 	<-ctx.Done()
 	log.Info("Shutting down")
 	nats.Disconnect()
+	spool.Stop()
 	_ = router.Shutdown()
 }
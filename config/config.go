@@ -24,13 +24,118 @@ type Location struct {
 	Longitude float64 `yaml:"longitude"`
 }
 
+type Output struct {
+	Buffer int     `yaml:"buffer"`
+	Rate   float64 `yaml:"rate"`
+}
+
+type Backend struct {
+	Type    string   `yaml:"type"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+}
+
+type Spool struct {
+	Enabled bool   `yaml:"enabled"`
+	Port    int    `yaml:"port"`
+	Dir     string `yaml:"dir"`
+	Size    int    `yaml:"size"`
+}
+
+type Process struct {
+	CPU        float64 `yaml:"cpu"`
+	Memory     int64   `yaml:"memory"`
+	Nice       int     `yaml:"nice"`
+	IOClass    string  `yaml:"ioClass"`
+	IOPriority int     `yaml:"ioPriority"`
+	User       string  `yaml:"user"`
+	Group      string  `yaml:"group"`
+	Dir        string  `yaml:"dir"`
+	Cgroup     string  `yaml:"cgroup"`
+}
+
+type Retry struct {
+	Attempts   int   `yaml:"attempts"`
+	Backoff    int64 `yaml:"backoff"`
+	MaxBackoff int64 `yaml:"maxBackoff"`
+}
+
+type Limits struct {
+	MinFreq     int64 `yaml:"minFreq"`
+	MaxFreq     int64 `yaml:"maxFreq"`
+	MaxSampRate int64 `yaml:"maxSampRate"`
+	MaxDuration int64 `yaml:"maxDuration"`
+}
+
+type Device struct {
+	Name   string `yaml:"name"`
+	Index  string `yaml:"index"`
+	Limits Limits `yaml:"limits"`
+}
+
 type Node struct {
-	Port int `yaml:"port"`
+	Port    int      `yaml:"port"`
+	Queue   string   `yaml:"queue"`
+	History string   `yaml:"history"`
+	Output  Output   `yaml:"output"`
+	Backend Backend  `yaml:"backend"`
+	Spool   Spool    `yaml:"spool"`
+	Limits  Limits   `yaml:"limits"`
+	Devices []Device `yaml:"devices"`
+
+	// Flags (by name, see node.sensor) which measurement requests can override
+	Overrides []string `yaml:"overrides"`
+
+	// Named sets of flags (by name, see node.sensor) layered over the defaults
+	Profiles map[string]map[string]string `yaml:"profiles"`
+
+	Process Process `yaml:"process"`
+	Retry   Retry   `yaml:"retry"`
+
+	// Seconds without progress after which the sensor process is killed, extended
+	// to a few time resolution intervals of the campaign
+	Watchdog int `yaml:"watchdog"`
+
+	HardwareCheck bool `yaml:"hardwareCheck"`
+}
+
+type JetStream struct {
+	Enabled    bool   `yaml:"enabled"`
+	Stream     string `yaml:"stream"`
+	MaxAge     int    `yaml:"maxAge"`
+	AckWait    int    `yaml:"ackWait"`
+	MaxDeliver int    `yaml:"maxDeliver"`
+	Retry      int    `yaml:"retry"`
+}
+
+type TLS struct {
+	Enabled bool   `yaml:"enabled"`
+	CA      string `yaml:"ca"`
+	Cert    string `yaml:"cert"`
+	Key     string `yaml:"key"`
+}
+
+type Heartbeat struct {
+	Interval     int  `yaml:"interval"`
+	BusyInterval int  `yaml:"busyInterval"`
+	Full         bool `yaml:"full"`
 }
 
 type NATS struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host           string    `yaml:"host"`
+	Port           int       `yaml:"port"`
+	Servers        []string  `yaml:"servers"`
+	Randomize      bool      `yaml:"randomize"`
+	ConnectTimeout int       `yaml:"connectTimeout"`
+	PingInterval   int       `yaml:"pingInterval"`
+	MaxPingsOut    int       `yaml:"maxPingsOut"`
+	ReconnectWait  int       `yaml:"reconnectWait"`
+	Token          string    `yaml:"token"`
+	NKey           string    `yaml:"nkey"`
+	Credentials    string    `yaml:"credentials"`
+	TLS            TLS       `yaml:"tls"`
+	JetStream      JetStream `yaml:"jetstream"`
+	Heartbeat      Heartbeat `yaml:"heartbeat"`
 }
 
 type NodeConfig struct {
@@ -45,10 +150,61 @@ var defaultConfig = NodeConfig{
 		Port: 2022,
 	},
 	Node: Node{
-		Port: 9090,
+		Port:    9090,
+		Queue:   "/var/lib/openrfsense/queue.json",
+		History: "/var/lib/openrfsense/history.json",
+		Output: Output{
+			Buffer: 500,
+			Rate:   20,
+		},
+		Backend: Backend{
+			Type: "orfs",
+		},
+		HardwareCheck: false,
+		Overrides: []string{
+			"averagingFactor",
+			"fftBatchLength",
+			"gain",
+			"log2FFTsize",
+			"samplingRate",
+			"segmentOverlap",
+			"windowingFunction",
+		},
+		Spool: Spool{
+			Enabled: false,
+			Port:    2023,
+			Dir:     "/var/lib/openrfsense/spool",
+			Size:    512,
+		},
+		Process: Process{
+			Cgroup: "/sys/fs/cgroup/openrfsense",
+		},
+		Retry: Retry{
+			Attempts:   3,
+			Backoff:    5,
+			MaxBackoff: 60,
+		},
+		Watchdog: 60,
 	},
 	NATS: NATS{
-		Port: 0,
+		Port:           0,
+		Randomize:      true,
+		ConnectTimeout: 2,
+		PingInterval:   120,
+		MaxPingsOut:    2,
+		ReconnectWait:  2,
+		Heartbeat: Heartbeat{
+			Interval:     30,
+			BusyInterval: 5,
+		},
+		JetStream: JetStream{
+			Enabled:    false,
+			Stream:     "CAMPAIGNS",
+			MaxAge:     604800,
+			AckWait:    30,
+			MaxDeliver: 10,
+			Retry:      30,
+		},
 	},
 }
 
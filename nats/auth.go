@@ -0,0 +1,147 @@
+package nats
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/knadh/koanf"
+	nats "github.com/nats-io/nats.go"
+)
+
+// Type TLSConfig describes the TLS connection to the NATS server, as found in the
+// configuration under nats.tls.
+type TLSConfig struct {
+	// Require TLS, verifying the server with the system certificate authorities
+	// unless a CA is given
+	Enabled bool `yaml:"enabled"`
+
+	// PEM file with the certificate authorities used to verify the server
+	CA string `yaml:"ca"`
+
+	// PEM files with the client certificate and its private key, for mutual TLS
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// Type AuthConfig describes how the node authenticates to the NATS server, as found
+// in the configuration under nats.
+type AuthConfig struct {
+	Token string `yaml:"token"`
+
+	// File containing an NKey seed
+	NKey string `yaml:"nkey"`
+
+	// Credentials file (.creds) containing a user JWT and its NKey seed
+	Credentials string `yaml:"credentials"`
+
+	TLS TLSConfig `yaml:"tls"`
+}
+
+// Reads the authentication and TLS settings from the configuration and returns the
+// relative connection options. A non-empty token found in tokenFile takes
+// precedence over nats.token, while an NKey or credentials take precedence over
+// any token, since one is always configured. Only one of NKey and credentials can
+// be used.
+func authOptions(config *koanf.Koanf, tokenFile string) ([]nats.Option, error) {
+	ac := AuthConfig{}
+	err := config.UnmarshalWithConf("nats", &ac, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := readToken(tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		ac.Token = token
+	}
+	if ac.Token != "" && (ac.NKey != "" || ac.Credentials != "") {
+		log.Debug("NKey or credentials configured, ignoring the token")
+		ac.Token = ""
+	}
+
+	methods := []string{}
+	opts := []nats.Option{}
+
+	if ac.Token != "" {
+		methods = append(methods, "token")
+		opts = append(opts, nats.Token(ac.Token))
+	}
+
+	if ac.NKey != "" {
+		methods = append(methods, "nkey")
+		opt, err := nats.NkeyOptionFromSeed(ac.NKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not load NKey seed %s", err, ac.NKey)
+		}
+		opts = append(opts, opt)
+	}
+
+	if ac.Credentials != "" {
+		methods = append(methods, "credentials")
+		_, err := os.Stat(ac.Credentials)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not load credentials", err)
+		}
+		opts = append(opts, nats.UserCredentials(ac.Credentials))
+	}
+
+	if len(methods) > 1 {
+		return nil, fmt.Errorf("only one NATS authentication method can be used, found %s", strings.Join(methods, ", "))
+	}
+
+	tlsOpts, err := tlsOptions(ac.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, tlsOpts...), nil
+}
+
+// Returns the connection options for TLS, if enabled or if any file is given.
+func tlsOptions(tc TLSConfig) ([]nats.Option, error) {
+	if (tc.Cert == "") != (tc.Key == "") {
+		return nil, fmt.Errorf("both a client certificate and a key are required for mutual TLS")
+	}
+
+	opts := []nats.Option{}
+	if tc.Enabled {
+		opts = append(opts, nats.Secure())
+	}
+	for _, file := range []string{tc.CA, tc.Cert, tc.Key} {
+		if file == "" {
+			continue
+		}
+		_, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not load TLS configuration", err)
+		}
+	}
+	if tc.CA != "" {
+		opts = append(opts, nats.RootCAs(tc.CA))
+	}
+	if tc.Cert != "" {
+		opts = append(opts, nats.ClientCert(tc.Cert, tc.Key))
+	}
+
+	return opts, nil
+}
+
+// Returns the token found in a file, with surrounding whitespace removed. Missing
+// files are not an error, since the token can also be found in the configuration.
+func readToken(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Debugf("token file %s not found", path)
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: could not read token file", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
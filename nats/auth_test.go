@@ -0,0 +1,161 @@
+package nats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/nats-io/nats-server/v2/server"
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+func authConfig(t *testing.T, values map[string]interface{}) *koanf.Koanf {
+	k := koanf.New(".")
+	err := k.Load(confmap.Provider(values, "."), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestAuthOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, _ := user.Seed()
+	pub, _ := user.PublicKey()
+	seedFile := filepath.Join(dir, "user.nk")
+	err = os.WriteFile(seedFile, seed, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenFile := filepath.Join(dir, "token.txt")
+	err = os.WriteFile(tokenFile, []byte("file-token\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      server.Options
+		values    map[string]interface{}
+		tokenFile string
+		wantErr   bool
+	}{
+		{
+			name:      "token file over config",
+			opts:      server.Options{Authorization: "file-token"},
+			values:    map[string]interface{}{"nats.token": "config-token"},
+			tokenFile: tokenFile,
+		},
+		{
+			name:      "missing token file",
+			opts:      server.Options{Authorization: "config-token"},
+			values:    map[string]interface{}{"nats.token": "config-token"},
+			tokenFile: filepath.Join(dir, "missing.txt"),
+		},
+		{
+			name:   "nkey",
+			opts:   server.Options{Nkeys: []*server.NkeyUser{{Nkey: pub}}},
+			values: map[string]interface{}{"nats.nkey": seedFile},
+		},
+		{
+			name:      "nkey over token",
+			opts:      server.Options{Nkeys: []*server.NkeyUser{{Nkey: pub}}},
+			values:    map[string]interface{}{"nats.token": "config-token", "nats.nkey": seedFile},
+			tokenFile: tokenFile,
+		},
+		{
+			name:    "nkey and credentials",
+			values:  map[string]interface{}{"nats.nkey": seedFile, "nats.credentials": seedFile},
+			wantErr: true,
+		},
+		{
+			name:    "certificate without key",
+			values:  map[string]interface{}{"nats.tls.cert": seedFile},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := authOptions(authConfig(t, tt.values), tt.tokenFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			so := tt.opts
+			so.Host, so.Port, so.NoLog, so.NoSigs = "127.0.0.1", -1, true, true
+			s, err := server.NewServer(&so)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go s.Start()
+			defer s.Shutdown()
+			if !s.ReadyForConnections(5 * time.Second) {
+				t.Fatal("server not ready")
+			}
+
+			nc, err := nats.Connect(s.ClientURL(), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nc.Close()
+		})
+	}
+}
+
+func TestAuthOptionsDefaultConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, _ := user.Seed()
+	seedFile := filepath.Join(dir, "user.nk")
+	err = os.WriteFile(seedFile, seed, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := filepath.Join(dir, "token.txt")
+	err = os.WriteFile(tokenFile, []byte("file-token\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The shipped configuration has a token, which must not get in the way of an
+	// NKey, even with a token file
+	k := koanf.New(".")
+	err = k.Load(file.Provider("../config.yml"), yaml.Parser())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.String("nats.token") == "" {
+		t.Fatal("expected a token in the default configuration")
+	}
+	err = k.Load(confmap.Provider(map[string]interface{}{"nats.nkey": seedFile}, "."), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tf := range []string{"", tokenFile} {
+		_, err := authOptions(k, tf)
+		if err != nil {
+			t.Fatalf("token file %q: %v", tf, err)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package nats
 
 import (
-	"fmt"
 	"math"
 	"strings"
 
@@ -9,6 +8,7 @@ import (
 	nats "github.com/nats-io/nats.go"
 
 	"github.com/openrfsense/common/logging"
+	"github.com/openrfsense/node/stats"
 	"github.com/openrfsense/node/system"
 )
 
@@ -22,6 +22,16 @@ type Route struct {
 var routes = []Route{
 	{".all", HandlerStatsBrief},
 	{"stats", HandlerStats},
+	{"cancel", HandlerCancel},
+	{".all.cancel", HandlerCancelBroadcast},
+	{"log", HandlerLog},
+	{"campaigns", HandlerCampaigns},
+	{"profiles", HandlerProfiles},
+}
+
+// The subjects carrying campaign requests, used unless they are delivered through
+// JetStream (see nats.jetstream)
+var measurementRoutes = []Route{
 	{".all.aggregated", HandlerAggregatedMeasurement},
 	{".all.raw", HandlerRawMeasurement},
 }
@@ -37,22 +47,51 @@ var (
 )
 
 // Initializes the internal NATS connection and sets up handlers for various subjects.
-// Uses the token found in tokenFile but also looks for the token in the config, under
-// nats.token (ORFS_NATS_TOKEN in env variables).
+// Uses the token found in tokenFile if present, otherwise the token in the config, under
+// nats.token (ORFS_NATS_TOKEN in env variables). NKey, credentials and TLS settings are
+// also read from the config (see authOptions), along with the list of servers to fail
+// over between (see ConnectionConfig).
 func Init(config *koanf.Koanf, tokenFile string) error {
-	addr := fmt.Sprintf("nats://%s:%d", config.String("nats.host"), config.MustInt("nats.port"))
-	token := config.MustString("nats.token")
 	errors = make(chan error, 1)
 
-	// Connect and encode the connection
-	var err error
-	conn, err = connect(addr, system.ID(), token)
+	cc, err := loadConnectionConfig(config)
+	if err != nil {
+		return err
+	}
+
+	auth, err := authOptions(config, tokenFile)
+	if err != nil {
+		return err
+	}
+
+	jsc, err := loadJetStreamConfig(config)
 	if err != nil {
 		return err
 	}
 
-	// Register the routes
-	for _, route := range routes {
+	hb, err := newHeartbeat(config, system.ID())
+	if err != nil {
+		return err
+	}
+
+	// Connect and encode the connection
+	conn, err = connect(cc.urls(), system.ID(), append(cc.options(), auth...)...)
+	if err != nil {
+		return err
+	}
+	stats.SetConnectionSource(func() stats.StatsConnection {
+		return connectionStats(conn.Conn)
+	})
+
+	// Register the routes, campaign requests are received either directly or
+	// through durable JetStream consumers
+	registered := routes
+	if jsc.Enabled {
+		go startJetStream(conn.Conn, system.ID(), jsc)
+	} else {
+		registered = append(registered, measurementRoutes...)
+	}
+	for _, route := range registered {
 		err = handle(conn, system.ID(), route.Subject, route.Handler)
 		if err != nil {
 			log.Error(err)
@@ -60,9 +99,15 @@ func Init(config *koanf.Koanf, tokenFile string) error {
 	}
 
 	// Start async error logger
-	go errorLogger(errors)
+	go errorLogger(conn, errors)
 	// Start manager data sender
 	go sendManagerData(conn, errors)
+	// Start sensor events sender
+	go sendEvents(conn, errors)
+	// Start periodic heartbeats
+	if hb != nil {
+		go hb.run(conn, errors)
+	}
 
 	return nil
 }
@@ -78,21 +123,23 @@ func Disconnect() {
 	}
 }
 
-// Creates an encoded connection to the specified NATS address with a client ID.
-func connect(addr string, clientId string, token string) (*nats.EncodedConn, error) {
-	c, err := nats.Connect(
-		addr,
+// Creates an encoded connection to the specified NATS addresses (comma-separated) with
+// a client ID and extra options (failover, authentication and TLS).
+func connect(addr string, clientId string, extra ...nats.Option) (*nats.EncodedConn, error) {
+	opts := append([]nats.Option{
 		nats.Name(clientId),
-		nats.Token(token),
 		nats.RetryOnFailedConnect(true),
 		nats.MaxReconnects(math.MaxInt),
 		nats.ReconnectHandler(func(c *nats.Conn) {
-			log.Info("Connection estabilished")
+			log.Infof("Connection estabilished to %s", c.ConnectedUrlRedacted())
 		}),
 		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
 			log.Warnf("Connection lost: %v", err)
+			lastDisconnect.disconnected(err)
 		}),
-	)
+	}, extra...)
+
+	c, err := nats.Connect(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,136 @@
+package nats
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knadh/koanf"
+	nats "github.com/nats-io/nats.go"
+
+	"github.com/openrfsense/node/stats"
+)
+
+// Type ConnectionConfig describes the NATS servers and how the node connects to
+// them, as found in the configuration under nats.
+type ConnectionConfig struct {
+	// Single server, used if no servers are listed
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// URLs of the servers (nats://host:port or tls://host:port)
+	Servers []string `yaml:"servers"`
+
+	// Whether the servers are tried in random order
+	Randomize bool `yaml:"randomize"`
+
+	// Seconds to wait when connecting to a single server
+	ConnectTimeout int `yaml:"connectTimeout"`
+
+	// Seconds between pings to the server, and number of unanswered pings after
+	// which the connection is considered lost
+	PingInterval int `yaml:"pingInterval"`
+	MaxPingsOut  int `yaml:"maxPingsOut"`
+
+	// Seconds to wait before reconnecting to a server
+	ReconnectWait int `yaml:"reconnectWait"`
+}
+
+// Type connectionState keeps track of the connection losses.
+type connectionState struct {
+	sync.Mutex
+	reason string
+	time   *time.Time
+}
+
+// Last connection loss
+var lastDisconnect = &connectionState{}
+
+// Loads the connection configuration from nats.
+func loadConnectionConfig(config *koanf.Koanf) (ConnectionConfig, error) {
+	cc := ConnectionConfig{}
+	err := config.UnmarshalWithConf("nats", &cc, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return cc, err
+	}
+
+	if len(cc.Servers) == 0 && cc.Host == "" {
+		return cc, fmt.Errorf("no NATS servers configured")
+	}
+	return cc, nil
+}
+
+// Returns the server URLs as understood by nats.Connect.
+func (cc ConnectionConfig) urls() string {
+	if len(cc.Servers) == 0 {
+		return fmt.Sprintf("nats://%s:%d", cc.Host, cc.Port)
+	}
+	return strings.Join(cc.Servers, ",")
+}
+
+// Returns the connection options for failover between the servers.
+func (cc ConnectionConfig) options() []nats.Option {
+	opts := []nats.Option{}
+	if !cc.Randomize {
+		opts = append(opts, nats.DontRandomize())
+	}
+	if cc.ConnectTimeout > 0 {
+		opts = append(opts, nats.Timeout(time.Duration(cc.ConnectTimeout)*time.Second))
+	}
+	if cc.PingInterval > 0 {
+		opts = append(opts, nats.PingInterval(time.Duration(cc.PingInterval)*time.Second))
+	}
+	if cc.MaxPingsOut > 0 {
+		opts = append(opts, nats.MaxPingsOutstanding(cc.MaxPingsOut))
+	}
+	if cc.ReconnectWait > 0 {
+		opts = append(opts, nats.ReconnectWait(time.Duration(cc.ReconnectWait)*time.Second))
+	}
+
+	return opts
+}
+
+// Records a connection loss.
+func (cs *connectionState) disconnected(err error) {
+	reason := "connection closed"
+	if err != nil {
+		reason = err.Error()
+	}
+	now := time.Now()
+
+	cs.Lock()
+	cs.reason, cs.time = reason, &now
+	cs.Unlock()
+}
+
+// Returns the state of a connection, with credentials removed from server URLs.
+func connectionStats(c *nats.Conn) stats.StatsConnection {
+	servers := []string{}
+	for _, s := range c.Servers() {
+		servers = append(servers, redactURL(s))
+	}
+
+	sc := stats.StatsConnection{
+		Connected:  c.IsConnected(),
+		Server:     c.ConnectedUrlRedacted(),
+		Servers:    servers,
+		Reconnects: c.Stats().Reconnects,
+	}
+
+	lastDisconnect.Lock()
+	sc.LastDisconnect, sc.LastDisconnectTime = lastDisconnect.reason, lastDisconnect.time
+	lastDisconnect.Unlock()
+
+	return sc
+}
+
+// Replaces the password in a URL, if any.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,42 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func TestFailover(t *testing.T) {
+	s1, s2 := runServer(t), runServer(t)
+	lastDisconnect = &connectionState{}
+
+	cc := ConnectionConfig{
+		Servers:        []string{s1.ClientURL(), s2.ClientURL()},
+		ConnectTimeout: 1,
+	}
+	c, err := connect(cc.urls(), "test", append(cc.options(), nats.ReconnectWait(50*time.Millisecond))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	sc := connectionStats(c.Conn)
+	if !sc.Connected || sc.Server != s1.ClientURL() || sc.Reconnects != 0 || sc.LastDisconnectTime != nil {
+		t.Fatalf("unexpected stats before failover: %+v", sc)
+	}
+
+	s1.Shutdown()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Conn.ConnectedUrl() != s2.ClientURL() {
+		if time.Now().After(deadline) {
+			t.Fatal("did not fail over to the second server")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	sc = connectionStats(c.Conn)
+	if !sc.Connected || sc.Server != s2.ClientURL() || sc.Reconnects != 1 || sc.LastDisconnect == "" || sc.LastDisconnectTime == nil {
+		t.Fatalf("unexpected stats after failover: %+v", sc)
+	}
+}
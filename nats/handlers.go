@@ -1,12 +1,68 @@
 package nats
 
 import (
+	goErrors "errors"
+
 	"github.com/openrfsense/common/types"
 	"github.com/openrfsense/node/sensor"
 	"github.com/openrfsense/node/stats"
 	"github.com/openrfsense/node/system"
+
+	commonStats "github.com/openrfsense/common/stats"
 )
 
+// Type CampaignResult is sent back to the backend for each campaign-related request
+// (measurement or cancellation), reporting whether the node accepted it and why not.
+type CampaignResult struct {
+	SensorID   string `json:"sensorId"`
+	CampaignId string `json:"campaignId"`
+	Accepted   bool   `json:"accepted"`
+
+	// Reason for the rejection, empty if the campaign was accepted
+	Reason string `json:"reason,omitempty"`
+
+	// Command line which will run the campaign (command first), if accepted. The
+	// collector address is replaced by a local relay when the data is metered for
+	// the watchdog, the command actually run is in the result published on
+	// node.all.output
+	Command []string `json:"command,omitempty"`
+
+	// Brief system stats, as returned by stats.GetStatsBrief
+	Stats *commonStats.Stats `json:"stats,omitempty"`
+}
+
+// Type CampaignRequest is sent by the backend to act on an existing campaign
+// (for example, to stop it early).
+type CampaignRequest struct {
+	CampaignId string `json:"campaignId"`
+}
+
+// Type AggregatedRequest is an aggregated measurement request with optional
+// command line flag overrides for this campaign only.
+type AggregatedRequest struct {
+	types.AggregatedMeasurementRequest
+
+	// Name of a profile from node.profiles, layered over the default flags
+	Profile string `json:"profile,omitempty"`
+
+	// Flag values by configuration name (see node.sensor), only the flags
+	// listed in node.overrides are accepted
+	Flags sensor.FlagOverrides `json:"flags,omitempty"`
+}
+
+// Type RawRequest is a raw measurement request with optional command line
+// flag overrides for this campaign only.
+type RawRequest struct {
+	types.RawMeasurementRequest
+
+	// Name of a profile from node.profiles, layered over the default flags
+	Profile string `json:"profile,omitempty"`
+
+	// Flag values by configuration name (see node.sensor), only the flags
+	// listed in node.overrides are accepted
+	Flags sensor.FlagOverrides `json:"flags,omitempty"`
+}
+
 // Responds with full system stats (system.GetStats).
 func HandlerStats(subject string, reply string, _ interface{}) {
 	stat, err := stats.GetStats()
@@ -29,26 +85,133 @@ func HandlerStatsBrief(subject string, reply string, _ interface{}) {
 	_ = conn.Publish(reply, *stat)
 }
 
-// Starts an aggregated measurement and sends back brief stats.
-func HandlerAggregatedMeasurement(subject string, reply string, amr *types.AggregatedMeasurementRequest) {
-	for _, id := range amr.Sensors {
-		if id == system.ID() {
-			log.Debugf("got measurement request: %#v\n", amr)
-			go sensor.WithAggregated(*amr).Run()
-			HandlerStatsBrief("", reply, nil)
-			return
-		}
+// Responds with the records of the campaigns run by the node, most recent first.
+func HandlerCampaigns(subject string, reply string, _ interface{}) {
+	_ = conn.Publish(reply, sensor.History())
+}
+
+// Responds with the sensor profiles available on the node.
+func HandlerProfiles(subject string, reply string, _ interface{}) {
+	_ = conn.Publish(reply, sensor.Profiles())
+}
+
+// Schedules an aggregated measurement and sends back the result.
+func HandlerAggregatedMeasurement(subject string, reply string, amr *AggregatedRequest) {
+	if !forNode(amr.Sensors) {
+		return
+	}
+
+	log.Debugf("got measurement request: %#v\n", amr)
+	command, err := scheduleAggregated(amr)
+	replyCampaign(reply, amr.CampaignId, command, err)
+}
+
+// Schedules a raw measurement and sends back the result.
+func HandlerRawMeasurement(subject string, reply string, rmr *RawRequest) {
+	if !forNode(rmr.Sensors) {
+		return
 	}
+
+	log.Debugf("got measurement request: %#v\n", rmr)
+	command, err := scheduleRaw(rmr)
+	replyCampaign(reply, rmr.CampaignId, command, err)
 }
 
-// Starts a raw measurement and sends back brief stats.
-func HandlerRawMeasurement(subject string, reply string, rmr *types.RawMeasurementRequest) {
-	for _, id := range rmr.Sensors {
-		if id == system.ID() {
-			log.Debugf("got measurement request: %#v\n", rmr)
-			go sensor.WithRaw(*rmr).Run()
-			HandlerStatsBrief("", reply, nil)
-			return
-		}
+// Cancels a running or scheduled campaign and sends back the result.
+func HandlerCancel(subject string, reply string, cr *CampaignRequest) {
+	log.Debugf("got cancel request: %#v\n", cr)
+	err := sensor.Cancel(cr.CampaignId)
+	replyCampaign(reply, cr.CampaignId, nil, err)
+}
+
+// Cancels a running or scheduled campaign and sends back the result, only if
+// the campaign is known to this node.
+func HandlerCancelBroadcast(subject string, reply string, cr *CampaignRequest) {
+	err := sensor.Cancel(cr.CampaignId)
+	if goErrors.Is(err, sensor.ErrUnknownCampaign) {
+		return
 	}
+	log.Debugf("got cancel request: %#v\n", cr)
+	replyCampaign(reply, cr.CampaignId, nil, err)
+}
+
+// Responds with the buffered output lines of the current or last campaign.
+func HandlerLog(subject string, reply string, cr *CampaignRequest) {
+	lines, err := sensor.Log(cr.CampaignId)
+	if err != nil {
+		log.Warn(err)
+		lines = []sensor.Line{}
+	}
+
+	_ = conn.Publish(reply, lines)
+}
+
+// Schedules the campaign described by an aggregated measurement request.
+func scheduleAggregated(amr *AggregatedRequest) ([]string, error) {
+	return scheduleCampaign(amr.CampaignId, amr.Profile, amr.Flags, func(flags sensor.CommandFlags) *sensor.Campaign {
+		return sensor.WithAggregated(amr.AggregatedMeasurementRequest, flags)
+	})
+}
+
+// Schedules the campaign described by a raw measurement request.
+func scheduleRaw(rmr *RawRequest) ([]string, error) {
+	return scheduleCampaign(rmr.CampaignId, rmr.Profile, rmr.Flags, func(flags sensor.CommandFlags) *sensor.Campaign {
+		return sensor.WithRaw(rmr.RawMeasurementRequest, flags)
+	})
+}
+
+// Applies the profile and flag overrides and schedules the campaign built from the
+// resulting flags. Returns the effective command line if the campaign was accepted.
+func scheduleCampaign(campaignId string, profile string, overrides sensor.FlagOverrides, build func(sensor.CommandFlags) *sensor.Campaign) ([]string, error) {
+	flags, err := sensor.WithProfile(profile, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	c := build(flags)
+	err = sensor.Schedule(c)
+	if err != nil {
+		return nil, err
+	}
+
+	command, err := sensor.CommandLine(c)
+	if err != nil {
+		log.Warnf("%v: could not generate command line for campaign %s", err, campaignId)
+	}
+	return command, nil
+}
+
+// Responds with a CampaignResult: the campaign is rejected if err is not nil.
+func replyCampaign(reply string, campaignId string, command []string, err error) {
+	res := newCampaignResult(campaignId, command, err)
+	if reply == "" {
+		return
+	}
+	pubErr := conn.Publish(reply, res)
+	if pubErr != nil {
+		errors <- pubErr
+	}
+}
+
+// Creates a CampaignResult with brief system stats: the campaign is rejected if
+// err is not nil.
+func newCampaignResult(campaignId string, command []string, err error) CampaignResult {
+	res := CampaignResult{
+		SensorID:   system.ID(),
+		CampaignId: campaignId,
+		Accepted:   err == nil,
+		Command:    command,
+	}
+	if err != nil {
+		log.Warnf("rejected campaign %s: %v", campaignId, err)
+		res.Reason = err.Error()
+	}
+
+	stat, statErr := stats.GetStatsBrief()
+	if statErr != nil {
+		errors <- statErr
+	}
+	res.Stats = stat
+
+	return res
 }
@@ -0,0 +1,135 @@
+package nats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/knadh/koanf"
+	nats "github.com/nats-io/nats.go"
+
+	commonStats "github.com/openrfsense/common/stats"
+	"github.com/openrfsense/node/sensor"
+	"github.com/openrfsense/node/stats"
+	"github.com/openrfsense/node/system"
+)
+
+// Type HeartbeatConfig describes how often the node publishes its stats, as found
+// in the configuration under nats.heartbeat.
+type HeartbeatConfig struct {
+	// Seconds between heartbeats, 0 disables them
+	Interval int `yaml:"interval"`
+
+	// Seconds between heartbeats while a campaign is running, defaults to Interval.
+	// Interval is rounded up to a multiple of it
+	BusyInterval int `yaml:"busyInterval"`
+
+	// Whether full stats (see stats.GetStats) are sent instead of brief ones
+	Full bool `yaml:"full"`
+}
+
+// Type Heartbeat is published periodically on node.$id.heartbeat.
+type Heartbeat struct {
+	SensorID string            `json:"sensorId"`
+	Status   sensor.StatusEnum `json:"status"`
+
+	// Seconds until the next heartbeat: the node can be considered lost if nothing
+	// is received for a few intervals
+	Interval float64 `json:"interval"`
+
+	Time  time.Time          `json:"time"`
+	Stats *commonStats.Stats `json:"stats"`
+}
+
+// Type heartbeat publishes the stats of the node at a rate depending on whether
+// it is busy.
+type heartbeat struct {
+	subject string
+	idle    time.Duration
+	busy    time.Duration
+	full    bool
+
+	// Returns true while a campaign is running
+	isBusy func() bool
+}
+
+// Loads the heartbeat configuration from nats.heartbeat. Returns nil if
+// heartbeats are disabled.
+func newHeartbeat(config *koanf.Koanf, clientId string) (*heartbeat, error) {
+	hc := HeartbeatConfig{}
+	err := config.UnmarshalWithConf("nats.heartbeat", &hc, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return nil, err
+	}
+
+	if hc.Interval < 0 || hc.BusyInterval < 0 {
+		return nil, fmt.Errorf("heartbeat intervals cannot be negative")
+	}
+	if hc.Interval == 0 {
+		return nil, nil
+	}
+	if hc.BusyInterval == 0 || hc.BusyInterval > hc.Interval {
+		hc.BusyInterval = hc.Interval
+	}
+	// Heartbeats are sent on ticks of the busy interval
+	if rem := hc.Interval % hc.BusyInterval; rem != 0 {
+		hc.Interval += hc.BusyInterval - rem
+	}
+
+	return &heartbeat{
+		subject: fmt.Sprintf("node.%s.heartbeat", clientId),
+		idle:    time.Duration(hc.Interval) * time.Second,
+		busy:    time.Duration(hc.BusyInterval) * time.Second,
+		full:    hc.Full,
+		isBusy: func() bool {
+			return sensor.Status() == sensor.Busy
+		},
+	}, nil
+}
+
+// Publishes a heartbeat right away and then every idle interval, or every busy
+// interval while a campaign is running. Returns when the connection is closed.
+// Blocking.
+func (hb *heartbeat) run(conn *nats.EncodedConn, errChan chan<- error) {
+	// Ticking at the faster rate lets the node switch to it as soon as a
+	// campaign starts
+	ticker := time.NewTicker(hb.busy)
+	defer ticker.Stop()
+
+	var last time.Time
+	for now := time.Now(); !conn.Conn.IsClosed(); now = <-ticker.C {
+		interval := hb.idle
+		if hb.isBusy() {
+			interval = hb.busy
+		}
+		// Leave some slack for the ticker
+		if now.Sub(last) < interval-hb.busy/2 {
+			continue
+		}
+		last = now
+
+		pubErr := hb.publish(conn, interval)
+		if pubErr != nil {
+			errChan <- pubErr
+		}
+	}
+}
+
+// Publishes a single heartbeat, announcing the given interval.
+func (hb *heartbeat) publish(conn *nats.EncodedConn, interval time.Duration) error {
+	getStats := stats.GetStatsBrief
+	if hb.full {
+		getStats = stats.GetStats
+	}
+	stat, err := getStats()
+	if err != nil {
+		return err
+	}
+
+	return conn.Publish(hb.subject, Heartbeat{
+		SensorID: system.ID(),
+		Status:   sensor.Status(),
+		Interval: interval.Seconds(),
+		Time:     time.Now(),
+		Stats:    stat,
+	})
+}
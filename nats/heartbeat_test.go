@@ -0,0 +1,97 @@
+package nats
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func TestNewHeartbeat(t *testing.T) {
+	hb, err := newHeartbeat(authConfig(t, map[string]interface{}{
+		"nats.heartbeat.interval":     7,
+		"nats.heartbeat.busyInterval": 5,
+	}), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hb.subject != "node.node1.heartbeat" || hb.idle != 10*time.Second || hb.busy != 5*time.Second {
+		t.Fatalf("unexpected heartbeat: %+v", hb)
+	}
+
+	hb, err = newHeartbeat(authConfig(t, map[string]interface{}{"nats.heartbeat.interval": 0}), "node1")
+	if err != nil || hb != nil {
+		t.Fatalf("expected heartbeats to be disabled, got %+v, %v", hb, err)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	s := runServer(t)
+	nc := connectTest(t, s)
+	c, err := nats.NewEncodedConn(nc, nats.JSON_ENCODER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var busy int32
+	hb := &heartbeat{
+		subject: "node.test.heartbeat",
+		idle:    400 * time.Millisecond,
+		busy:    50 * time.Millisecond,
+		isBusy: func() bool {
+			return atomic.LoadInt32(&busy) == 1
+		},
+	}
+
+	sub, err := connectTest(t, s).SubscribeSync(hb.subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errChan := make(chan error, 10)
+	go hb.run(c, errChan)
+
+	// Counts the heartbeats received in a period, checking the announced interval
+	count := func(period time.Duration, interval float64) int {
+		n := 0
+		deadline := time.Now().Add(period)
+		for {
+			msg, err := sub.NextMsg(time.Until(deadline))
+			if err == nats.ErrTimeout {
+				return n
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			beat := Heartbeat{}
+			_ = json.Unmarshal(msg.Data, &beat)
+			if beat.Stats == nil || beat.Interval != interval {
+				t.Fatalf("unexpected heartbeat: %+v", beat)
+			}
+			n++
+		}
+	}
+
+	if n := count(600*time.Millisecond, 0.4); n < 1 || n > 2 {
+		t.Fatalf("expected 1 or 2 heartbeats while idle, got %d", n)
+	}
+
+	atomic.StoreInt32(&busy, 1)
+	// Skip the heartbeat which may have been sent at the idle rate
+	time.Sleep(450 * time.Millisecond)
+	for {
+		if _, err := sub.NextMsg(time.Millisecond); err != nil {
+			break
+		}
+	}
+	if n := count(500*time.Millisecond, 0.05); n < 6 {
+		t.Fatalf("expected at least 6 heartbeats while busy, got %d", n)
+	}
+
+	select {
+	case err := <-errChan:
+		t.Fatal(err)
+	default:
+	}
+}
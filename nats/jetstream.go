@@ -0,0 +1,262 @@
+package nats
+
+import (
+	"encoding/json"
+	goErrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf"
+	nats "github.com/nats-io/nats.go"
+
+	"github.com/openrfsense/node/sensor"
+	"github.com/openrfsense/node/system"
+)
+
+// Subject where the results of campaign requests delivered through JetStream are
+// published, since the requests cannot be replied to.
+const resultSubject = "node.all.result"
+
+// Time between attempts at setting up the JetStream consumers.
+const jetStreamSetupRetry = 5 * time.Second
+
+// Returned (wrapped) when a campaign request cannot be decoded.
+var errMalformed = goErrors.New("malformed request")
+
+// Type JetStreamConfig describes how campaign requests are delivered through
+// JetStream, as found in the configuration under nats.jetstream.
+//
+// Once the stream exists, requests sent with core request/reply on
+// node.all.aggregated and node.all.raw are stored by the server, which answers
+// first with the PubAck of the stream: the campaign results are published on
+// node.all.result instead.
+type JetStreamConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Stream holding the campaign requests, created if missing
+	Stream string `yaml:"stream"`
+
+	// Seconds after which requests are discarded from the stream, 0 keeps them
+	// forever
+	MaxAge int `yaml:"maxAge"`
+
+	// Seconds the server waits for an acknowledgement before redelivering a request
+	AckWait int `yaml:"ackWait"`
+
+	// Maximum number of deliveries of a single request
+	MaxDeliver int `yaml:"maxDeliver"`
+
+	// Seconds before a request which failed for a temporary reason is redelivered
+	Retry int `yaml:"retry"`
+}
+
+// Type jsHandler decodes a campaign request and schedules it if it is meant for
+// this node. Returns an empty campaign ID if the request is for other nodes.
+type jsHandler func(data []byte) (campaignId string, command []string, err error)
+
+// The subjects (under node.all) delivered through JetStream and relative handlers
+var jsRoutes = map[string]jsHandler{
+	"aggregated": jsAggregated,
+	"raw":        jsRaw,
+}
+
+// Decodes and schedules an aggregated measurement request.
+func jsAggregated(data []byte) (string, []string, error) {
+	amr := &AggregatedRequest{}
+	err := json.Unmarshal(data, amr)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", errMalformed, err)
+	}
+	if !forNode(amr.Sensors) {
+		return "", nil, nil
+	}
+
+	log.Debugf("got measurement request: %#v\n", amr)
+	command, err := scheduleAggregated(amr)
+	return amr.CampaignId, command, err
+}
+
+// Decodes and schedules a raw measurement request.
+func jsRaw(data []byte) (string, []string, error) {
+	rmr := &RawRequest{}
+	err := json.Unmarshal(data, rmr)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", errMalformed, err)
+	}
+	if !forNode(rmr.Sensors) {
+		return "", nil, nil
+	}
+
+	log.Debugf("got measurement request: %#v\n", rmr)
+	command, err := scheduleRaw(rmr)
+	return rmr.CampaignId, command, err
+}
+
+// Loads the JetStream configuration from nats.jetstream.
+func loadJetStreamConfig(config *koanf.Koanf) (JetStreamConfig, error) {
+	jsc := JetStreamConfig{}
+	err := config.UnmarshalWithConf("nats.jetstream", &jsc, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return jsc, err
+	}
+
+	if jsc.Enabled && jsc.Stream == "" {
+		return jsc, fmt.Errorf("a stream name is required to use JetStream")
+	}
+	return jsc, nil
+}
+
+// Sets up the JetStream consumers, retrying until it succeeds since the server may
+// not be reachable yet. Blocking.
+func startJetStream(nc *nats.Conn, clientId string, jsc JetStreamConfig) {
+	for {
+		err := subscribeJetStream(nc, clientId, jsc, jsRoutes)
+		if err == nil {
+			return
+		}
+		log.Warnf("%v: could not set up JetStream, retrying in %s", err, jetStreamSetupRetry)
+
+		time.Sleep(jetStreamSetupRetry)
+		if nc.IsClosed() {
+			return
+		}
+	}
+}
+
+// Creates the stream if missing and subscribes a durable consumer for each route,
+// named after the client ID, so that requests published while the node is offline
+// are delivered when it reconnects. A new consumer only receives the requests
+// published after its creation.
+func subscribeJetStream(nc *nats.Conn, clientId string, jsc JetStreamConfig, handlers map[string]jsHandler) error {
+	js, err := nc.JetStream()
+	if err != nil {
+		return err
+	}
+
+	subjects := make([]string, 0, len(handlers))
+	for name := range handlers {
+		subjects = append(subjects, "node.all."+name)
+	}
+
+	_, err = js.StreamInfo(jsc.Stream)
+	if goErrors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     jsc.Stream,
+			Subjects: subjects,
+			Storage:  nats.FileStorage,
+			MaxAge:   time.Duration(jsc.MaxAge) * time.Second,
+		})
+		if err == nil {
+			log.Infof("created stream %s", jsc.Stream)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	retry := time.Duration(jsc.Retry) * time.Second
+	durableSafe := strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_")
+	for name, handler := range handlers {
+		handler := handler
+		subject := "node.all." + name
+		durable := durableSafe.Replace(clientId + "-" + name)
+
+		opts := []nats.SubOpt{
+			nats.Durable(durable),
+			nats.BindStream(jsc.Stream),
+			nats.DeliverNew(),
+			nats.ManualAck(),
+			nats.AckExplicit(),
+		}
+		if jsc.AckWait > 0 {
+			opts = append(opts, nats.AckWait(time.Duration(jsc.AckWait)*time.Second))
+		}
+		if jsc.MaxDeliver > 0 {
+			opts = append(opts, nats.MaxDeliver(jsc.MaxDeliver))
+		}
+
+		_, err = js.Subscribe(subject, func(msg *nats.Msg) {
+			deliver(msg, handler, jsc.MaxDeliver, retry)
+		}, opts...)
+		if err != nil {
+			return fmt.Errorf("%w: could not subscribe to %s", err, subject)
+		}
+		log.Debugf("registered durable consumer %s on subject %s", durable, subject)
+	}
+
+	return nil
+}
+
+// Handles a campaign request delivered through JetStream. The request is
+// acknowledged once the campaign is accepted or rejected and the result is
+// published, or redelivered later if the node could not decide because of a
+// temporary failure.
+func deliver(msg *nats.Msg, handler jsHandler, maxDeliver int, retry time.Duration) {
+	campaignId, command, err := handler(msg.Data)
+
+	switch {
+	case goErrors.Is(err, errMalformed):
+		log.Warn(err)
+		// Redelivering would not help
+		_ = msg.Term()
+		return
+
+	case campaignId == "":
+		// Meant for other nodes
+		_ = msg.Ack()
+		return
+
+	case goErrors.Is(err, sensor.ErrAlreadyScheduled):
+		// Accepted on a previous delivery, whose acknowledgement was lost
+		log.Debugf("campaign %s was redelivered", campaignId)
+		_ = msg.Ack()
+		return
+
+	case temporary(err) && !lastDelivery(msg, maxDeliver):
+		log.Warnf("%v: campaign %s will be redelivered in %s", err, campaignId, retry)
+		_ = msg.NakWithDelay(retry)
+		return
+	}
+
+	pubErr := conn.Publish(resultSubject, newCampaignResult(campaignId, command, err))
+	if pubErr != nil {
+		errors <- pubErr
+		_ = msg.Nak()
+		return
+	}
+
+	ackErr := msg.Ack()
+	if ackErr != nil {
+		errors <- ackErr
+	}
+}
+
+// Returns true if the error may not occur on a later attempt, e.g. when no SDR
+// device is attached yet or the attached ones could not be listed.
+func temporary(err error) bool {
+	return goErrors.Is(err, sensor.ErrNoHardware) || goErrors.Is(err, sensor.ErrHardwareUnknown)
+}
+
+// Returns true if the message will not be delivered again.
+func lastDelivery(msg *nats.Msg, maxDeliver int) bool {
+	if maxDeliver <= 0 {
+		return false
+	}
+
+	meta, err := msg.Metadata()
+	if err != nil {
+		return true
+	}
+	return meta.NumDelivered >= uint64(maxDeliver)
+}
+
+// Returns true if the list of sensor IDs contains this node.
+func forNode(sensors []string) bool {
+	for _, id := range sensors {
+		if id == system.ID() {
+			return true
+		}
+	}
+	return false
+}
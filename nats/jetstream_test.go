@@ -0,0 +1,146 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	nats "github.com/nats-io/nats.go"
+
+	"github.com/openrfsense/node/sensor"
+)
+
+func runServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func connectTest(t *testing.T, s *server.Server) *nats.Conn {
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func TestJetStream(t *testing.T) {
+	s := runServer(t)
+	jsc := JetStreamConfig{
+		Enabled:    true,
+		Stream:     "CAMPAIGNS",
+		AckWait:    5,
+		MaxDeliver: 5,
+	}
+
+	// The first attempt finds no hardware, the second one accepts the campaign
+	var calls int32
+	handlers := map[string]jsHandler{
+		"aggregated": func(data []byte) (string, []string, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return "c1", nil, fmt.Errorf("%w: no SDR device attached", sensor.ErrNoHardware)
+			}
+			return "c1", []string{"orfs_sensor"}, nil
+		},
+		"raw": jsRaw,
+	}
+
+	// Create the stream and the durable consumers, then go offline
+	nc := connectTest(t, s)
+	err := subscribeJetStream(nc, "node.1", jsc, handlers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Close()
+
+	pub := connectTest(t, s)
+	js, err := pub.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := json.Marshal(RawRequest{})
+	for subject, data := range map[string][]byte{
+		"node.all.aggregated": []byte(`{"campaignId":"c1"}`),
+		"node.all.raw":        other,
+	} {
+		_, err = js.Publish(subject, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = js.Publish("node.all.raw", []byte("not json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := pub.SubscribeSync(resultSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Come back online: the requests published meanwhile must be delivered
+	nc = connectTest(t, s)
+	conn, err = nats.NewEncodedConn(nc, nats.JSON_ENCODER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errors = make(chan error, 10)
+	err = subscribeJetStream(nc, "node.1", jsc, handlers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := results.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := CampaignResult{}
+	err = json.Unmarshal(msg.Data, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Accepted || res.CampaignId != "c1" || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("unexpected result after %d deliveries: %+v", calls, res)
+	}
+
+	// Every request must be acknowledged, and only one result published
+	for _, name := range []string{"node_1-aggregated", "node_1-raw"} {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			info, err := js.ConsumerInfo(jsc.Stream, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.NumAckPending == 0 && info.NumPending == 0 && info.NumRedelivered == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("consumer %s has unacknowledged requests: %+v", name, info)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	_, err = results.NextMsg(200 * time.Millisecond)
+	if err != nats.ErrTimeout {
+		t.Fatalf("expected a single result, got %v", err)
+	}
+}
@@ -1,38 +1,157 @@
 package nats
 
 import (
+	goErrors "errors"
+	"fmt"
+	"time"
+
 	nats "github.com/nats-io/nats.go"
 	"github.com/openrfsense/node/sensor"
 	"github.com/openrfsense/node/system"
 )
 
+// Code used for errors which do not come from a sensor run.
+const codeInternal = "INTERNAL"
+
+// Type Error is the structured envelope for errors published on node.all.error.
 type Error struct {
 	SensorID string `json:"sensorId"`
-	Error    error  `json:"error"`
+
+	// Machine-readable error class (see sensor.ErrorCode)
+	Code string `json:"code"`
+
+	// Human-readable error message
+	Message string `json:"message"`
+
+	// Campaign during which the error happened, if any
+	CampaignId string `json:"campaignId,omitempty"`
+
+	// Exit code of the sensor process, -1 if it did not exit normally
+	ExitCode *int `json:"exitCode,omitempty"`
+
+	// Name of the signal which terminated the sensor process, if any
+	Signal string `json:"signal,omitempty"`
+
+	// Last lines written by the sensor process on stderr
+	Stderr []string `json:"stderr,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// Wraps an error in the structured envelope, adding sensor run information if available.
+func newError(err error) Error {
+	e := Error{
+		SensorID: system.ID(),
+		Code:     codeInternal,
+		Message:  err.Error(),
+		Time:     time.Now(),
+	}
+
+	runErr := &sensor.RunError{}
+	if goErrors.As(err, &runErr) {
+		e.Code = string(runErr.Code)
+		e.CampaignId = runErr.CampaignId
+		e.ExitCode = &runErr.ExitCode
+		e.Signal = runErr.Signal
+		e.Stderr = runErr.Stderr
+		e.Time = runErr.Time
+	}
+
+	return e
 }
 
 type Output struct {
+	SensorID   string `json:"sensorId"`
+	CampaignId string `json:"campaignId"`
+	Output     string `json:"output"`
+
+	// How the sensor process ended
+	Result sensor.RunResult `json:"result"`
+}
+
+type Status struct {
+	SensorID       string            `json:"sensorId"`
+	CampaignId     string            `json:"campaignId"`
+	CampaignStatus string            `json:"campaignStatus"`
+	Status         sensor.StatusEnum `json:"status"`
+}
+
+// Type Retry reports a failed attempt at running a campaign, and whether it
+// will be retried.
+type Retry struct {
+	SensorID string `json:"sensorId"`
+	sensor.Attempt
+	Status sensor.StatusEnum `json:"status"`
+}
+
+// Type Stalled reports a campaign killed by the watchdog because its process
+// made no progress.
+type Stalled struct {
+	SensorID string `json:"sensorId"`
+	sensor.Stall
+	Status sensor.StatusEnum `json:"status"`
+}
+
+// Type SensorEvent is published on node.$id.events for every change in the state
+// of a sensing device.
+type SensorEvent struct {
 	SensorID string `json:"sensorId"`
-	Output   string `json:"output"`
+	sensor.Event
 }
 
+// Events waiting to be published, newer ones are dropped when full
+const eventsBuffer = 64
+
 // Waits for sensor manager errors or command output and sends a simple
 // identifiable message on the proper channel.
 func sendManagerData(conn *nats.EncodedConn, errChan chan<- error) {
 	for {
 		select {
 		case sensorErr := <-sensor.Err():
-			pubErr := conn.Publish("node.all.error", Error{
+			pubErr := conn.Publish("node.all.error", newError(sensorErr))
+			if pubErr != nil {
+				errChan <- pubErr
+			}
+		case campaignId := <-sensor.Cancelled():
+			pubErr := conn.Publish("node.all.status", Status{
+				SensorID:       system.ID(),
+				CampaignId:     campaignId,
+				CampaignStatus: string(sensor.OutcomeCancelled),
+				Status:         sensor.Status(),
+			})
+			if pubErr != nil {
+				errChan <- pubErr
+			}
+		case line := <-sensor.Lines():
+			subject := fmt.Sprintf("node.%s.campaign.%s.log", system.ID(), line.CampaignId)
+			pubErr := conn.Publish(subject, line)
+			if pubErr != nil {
+				errChan <- pubErr
+			}
+		case attempt := <-sensor.Retries():
+			pubErr := conn.Publish("node.all.retry", Retry{
 				SensorID: system.ID(),
-				Error:    sensorErr,
+				Attempt:  attempt,
+				Status:   sensor.Status(),
+			})
+			if pubErr != nil {
+				errChan <- pubErr
+			}
+		case stall := <-sensor.Stalls():
+			pubErr := conn.Publish("node.all.stalled", Stalled{
+				SensorID: system.ID(),
+				Stall:    stall,
+				Status:   sensor.Status(),
 			})
 			if pubErr != nil {
 				errChan <- pubErr
 			}
 		case output := <-sensor.Output():
 			pubErr := conn.Publish("node.all.output", Output{
-				SensorID: system.ID(),
-				Output:   output,
+				SensorID:   system.ID(),
+				CampaignId: output.Result.CampaignId,
+				Output:     output.Output,
+				Result:     output.Result,
 			})
 			if pubErr != nil {
 				errChan <- pubErr
@@ -41,10 +160,34 @@ func sendManagerData(conn *nats.EncodedConn, errChan chan<- error) {
 	}
 }
 
-// Simple consumer which logs error received on a channel.
-func errorLogger(errChan <-chan error) {
+// Publishes sensor events on node.$id.events as they happen.
+func sendEvents(conn *nats.EncodedConn, errChan chan<- error) {
+	events, unsubscribe := sensor.Events(eventsBuffer)
+	defer unsubscribe()
+
+	subject := fmt.Sprintf("node.%s.events", system.ID())
+	for e := range events {
+		pubErr := conn.Publish(subject, SensorEvent{
+			SensorID: system.ID(),
+			Event:    e,
+		})
+		if pubErr != nil {
+			errChan <- pubErr
+		}
+	}
+}
+
+// Simple consumer which logs errors received on a channel and reports them
+// on node.all.error.
+func errorLogger(conn *nats.EncodedConn, errChan <-chan error) {
 	for {
 		err := <-errChan
 		log.Error(err)
+
+		// Publishing errors are only logged, to avoid loops
+		pubErr := conn.Publish("node.all.error", newError(err))
+		if pubErr != nil {
+			log.Error(pubErr)
+		}
 	}
 }
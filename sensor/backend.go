@@ -0,0 +1,106 @@
+package sensor
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+
+	"github.com/knadh/koanf"
+)
+
+// Interface Backend describes a program which can run measurement campaigns,
+// such as orfs_sensor or any other SDR tool.
+type Backend interface {
+	// Returns a unique name for the backend, as used in the configuration
+	Name() string
+
+	// Returns the command line used to run the given campaign (command first),
+	// or nil if the backend does not run an external program
+	CommandLine(c *Campaign) ([]string, error)
+
+	// Starts running the given campaign, writing the process output on stdout and stderr
+	Start(c *Campaign, stdout io.Writer, stderr io.Writer) (Process, error)
+}
+
+// Interface Process describes a running campaign as started by a Backend.
+type Process interface {
+	// Asks the process to stop gracefully
+	Terminate() error
+
+	// Stops the process immediately
+	Kill() error
+
+	// Waits for the process to exit. The error is an *exec.ExitError if the
+	// process exited unsuccessfully
+	Wait() error
+}
+
+// Type execProcess implements Process for external commands.
+type execProcess struct {
+	*exec.Cmd
+
+	// Cgroup created for the process, if any
+	cgroup string
+}
+
+// execProcess implements Process.
+var _ Process = execProcess{}
+
+func (p execProcess) Terminate() error {
+	return p.Process.Signal(syscall.SIGTERM)
+}
+
+func (p execProcess) Kill() error {
+	return p.Process.Kill()
+}
+
+func (p execProcess) Wait() error {
+	defer isolation.release(p.cgroup)
+	return p.Cmd.Wait()
+}
+
+// Runs the command described by args (the first element is the executable) for
+// the given campaign, applying the limits configured under node.process.
+func startCommand(campaignId string, args []string, stdout io.Writer, stderr io.Writer) (Process, error) {
+	if len(args) == 0 || args[0] == "" {
+		return nil, fmt.Errorf("no command to run")
+	}
+
+	cmd, cgroup, err := isolation.command(campaignId, args)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	log.Debug(cmd.String())
+
+	err = cmd.Start()
+	if err != nil {
+		isolation.release(cgroup)
+		return nil, err
+	}
+
+	return execProcess{
+		Cmd:    cmd,
+		cgroup: cgroup,
+	}, nil
+}
+
+// Creates the backend described in the configuration under node.backend,
+// defaulting to orfs_sensor.
+func newBackend(config *koanf.Koanf) (Backend, error) {
+	switch name := config.String("node.backend.type"); name {
+	case "", orfsBackendName:
+		return orfsBackend{}, nil
+	case templateBackendName:
+		return newTemplateBackend(
+			config.String("node.backend.command"),
+			config.Strings("node.backend.args"),
+		)
+	case simulatedBackendName:
+		return newSimulatedBackend(config)
+	default:
+		return nil, fmt.Errorf("unknown sensor backend %s", name)
+	}
+}
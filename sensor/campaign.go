@@ -0,0 +1,66 @@
+package sensor
+
+import (
+	"time"
+)
+
+// Type Campaign describes a single measurement campaign as requested by the
+// backend, along with the command line flags needed to run it.
+type Campaign struct {
+	// Campaign ID (assigned by the backend)
+	Id string `json:"id"`
+
+	// Measurement type, either PSD (aggregated) or IQ (raw)
+	Type string `json:"type"`
+
+	// Campaign start datetime
+	Begin time.Time `json:"begin"`
+
+	// Campaign end datetime
+	End time.Time `json:"end"`
+
+	// Frequency range in Hz. Both are set to the center frequency for raw measurements
+	FreqMin int64 `json:"freqMin"`
+	FreqMax int64 `json:"freqMax"`
+
+	// Frequency resolution in Hz (aggregated measurements only)
+	FreqRes int64 `json:"freqRes,omitempty"`
+
+	// Time resolution in seconds (aggregated measurements only)
+	TimeRes int64 `json:"timeRes,omitempty"`
+
+	// Name of the device the campaign is scheduled on
+	Device string `json:"device,omitempty"`
+
+	// Flags to pass onto the orfs_sensor process
+	Flags CommandFlags `json:"flags"`
+
+	// Number of failed attempts at running the campaign
+	Attempt int `json:"attempt,omitempty"`
+
+	// Local campaigns (such as quick scans) are not saved in the queue or in the
+	// history, nor reported over NATS
+	local bool
+
+	// How the last run ended, set before done is closed
+	outcome Outcome
+
+	// Closed when the campaign is over, either run or removed from the queue (if set)
+	done chan struct{}
+}
+
+// Signals that the campaign is over, if anyone is waiting for it.
+func (c *Campaign) finish() {
+	if c.done != nil {
+		close(c.done)
+	}
+}
+
+// Returns true if the time windows of the two campaigns intersect. Campaigns
+// with the same ID always overlap.
+func (c *Campaign) overlaps(other *Campaign) bool {
+	if c.Id == other.Id {
+		return true
+	}
+	return c.Begin.Before(other.End) && other.Begin.Before(c.End)
+}
@@ -38,8 +38,10 @@ var DefaultFlags = CommandFlags{
 	Command: "orfs_sensor",
 }
 
+// Generates the full command line (command first) for orfs_sensor from the given flags.
+// Empty flags and positional arguments are skipped.
 func generateFlags(sip CommandFlags) []string {
-	ret := []string{}
+	ret := []string{sip.Command}
 
 	// Flagged arguments
 	for _, f := range structs.Fields(sip) {
@@ -57,7 +59,11 @@ func generateFlags(sip CommandFlags) []string {
 	}
 
 	// Suffixed arguments
-	ret = append(ret, sip.SensorId, sip.CampaignId, sip.MinFreq, sip.MaxFreq)
+	for _, arg := range []string{sip.SensorId, sip.CampaignId, sip.MinFreq, sip.MaxFreq} {
+		if strings.TrimSpace(arg) != "" {
+			ret = append(ret, arg)
+		}
+	}
 
 	return ret
 }
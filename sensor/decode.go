@@ -0,0 +1,259 @@
+package sensor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// Largest datum accepted when decoding Avro data without a container.
+const maxDatumSize = 4 * 1024 * 1024
+
+// Fields of the orfs_sensor (Electrosense) sample schema holding the center
+// frequency of a segment, the squared magnitude of each of its bins, the
+// frequency resolution and the timestamp. They are looked up by name at any
+// depth, so that nested records and unions are handled.
+const (
+	fieldCenterFreq    = "CenterFreq"
+	fieldSquaredMag    = "SquaredMag"
+	fieldFreqRes       = "FrequencyResolution"
+	fieldTimeSecs      = "TimeSecs"
+	fieldTimeMicrosecs = "TimeMicrosecs"
+)
+
+// Magic bytes at the beginning of an Avro object container file.
+var avroMagic = []byte("Obj\x01")
+
+// Returned (wrapped) when the data sent by the sensor cannot be decoded.
+var errFormat = errors.New("unknown data format")
+
+// Type segment is a part of a PSD sweep, as sent by the sensor for each hop.
+type segment struct {
+	time time.Time
+
+	// Frequency range covered by the bins, in Hz
+	freqMin float64
+	freqMax float64
+
+	// Linear power of each bin, from freqMin to freqMax
+	power []float64
+}
+
+// Type segmentDecoder decodes the PSD data sent by a sensor process to the
+// collector.
+type segmentDecoder struct {
+	// Avro schema used by orfs_sensor (see CommandFlags.SchemaFile)
+	schemaFile string
+
+	// Used to find the width of the bins when the data does not have it
+	sampRate float64
+}
+
+// Decodes segments until r is exhausted, calling onSegment for each one. The
+// format is detected from the first bytes: JSON lines (as sent by the simulated
+// backend), an Avro object container file or Avro datums written back to back
+// with the schema in schemaFile (as sent by orfs_sensor). Blocking.
+func (d segmentDecoder) decode(r *bufio.Reader, onSegment func(segment)) error {
+	head, err := r.Peek(len(avroMagic))
+	if len(head) == 0 {
+		return err
+	}
+
+	switch {
+	case head[0] == '{':
+		return d.decodeJSON(r, onSegment)
+	case bytes.Equal(head, avroMagic):
+		return d.decodeContainer(r, onSegment)
+	default:
+		return d.decodeDatums(r, onSegment)
+	}
+}
+
+// Decodes PSD frames sent as lines of JSON (see simFrame).
+func (d segmentDecoder) decodeJSON(r io.Reader, onSegment func(segment)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDatumSize)
+
+	for scanner.Scan() {
+		frame := simFrame{}
+		err := json.Unmarshal(scanner.Bytes(), &frame)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errFormat, err)
+		}
+		if frame.Type != "PSD" || len(frame.Values) == 0 {
+			continue
+		}
+
+		power := make([]float64, len(frame.Values))
+		for i, v := range frame.Values {
+			power[i] = math.Pow(10, v/10)
+		}
+		onSegment(segment{
+			time:    frame.Time,
+			freqMin: float64(frame.FreqMin),
+			freqMax: float64(frame.FreqMax),
+			power:   power,
+		})
+	}
+
+	return scanner.Err()
+}
+
+// Decodes an Avro object container file, which carries its own schema.
+func (d segmentDecoder) decodeContainer(r io.Reader, onSegment func(segment)) error {
+	ocf, err := goavro.NewOCFReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errFormat, err)
+	}
+
+	for ocf.Scan() {
+		datum, err := ocf.Read()
+		if err != nil {
+			return fmt.Errorf("%w: %v", errFormat, err)
+		}
+		if seg, ok := d.avroSegment(datum); ok {
+			onSegment(seg)
+		}
+	}
+
+	return ocf.Err()
+}
+
+// Decodes Avro datums written back to back, using the schema file.
+func (d segmentDecoder) decodeDatums(r io.Reader, onSegment func(segment)) error {
+	if d.schemaFile == "" {
+		return fmt.Errorf("%w: no Avro schema file configured", errFormat)
+	}
+	schema, err := os.ReadFile(d.schemaFile)
+	if err != nil {
+		return fmt.Errorf("%w: could not read Avro schema", err)
+	}
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return fmt.Errorf("%w: could not parse Avro schema %s", err, d.schemaFile)
+	}
+
+	buf := []byte{}
+	chunk := make([]byte, 32*1024)
+	eof := false
+	for {
+		if len(buf) > 0 {
+			datum, rest, err := codec.NativeFromBinary(buf)
+			if err == nil {
+				buf = rest
+				if seg, ok := d.avroSegment(datum); ok {
+					onSegment(seg)
+				}
+				continue
+			}
+			// Datums can be split across reads
+			if !shortBuffer(err) || eof || len(buf) > maxDatumSize {
+				return fmt.Errorf("%w: %v", errFormat, err)
+			}
+		}
+		if eof {
+			return nil
+		}
+
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if errors.Is(err, io.EOF) {
+			eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Returns true if decoding failed only because the datum is incomplete. The
+// Avro library does not wrap io.ErrShortBuffer.
+func shortBuffer(err error) bool {
+	return errors.Is(err, io.ErrShortBuffer) || strings.Contains(err.Error(), io.ErrShortBuffer.Error())
+}
+
+// Extracts a segment from a decoded Avro sample. Returns false if the sample has
+// no center frequency or no bins.
+func (d segmentDecoder) avroSegment(datum interface{}) (segment, bool) {
+	center, ok := toFloat(findField(datum, fieldCenterFreq))
+	if !ok {
+		return segment{}, false
+	}
+	mags, _ := findField(datum, fieldSquaredMag).([]interface{})
+	if len(mags) == 0 {
+		return segment{}, false
+	}
+
+	power := make([]float64, 0, len(mags))
+	for _, m := range mags {
+		p, ok := toFloat(m)
+		if !ok {
+			return segment{}, false
+		}
+		power = append(power, p)
+	}
+
+	binWidth, ok := toFloat(findField(datum, fieldFreqRes))
+	if !ok || binWidth <= 0 {
+		binWidth = d.sampRate / float64(len(power))
+	}
+	span := binWidth * float64(len(power))
+
+	seg := segment{
+		time:    time.Now(),
+		freqMin: center - span/2,
+		freqMax: center + span/2,
+		power:   power,
+	}
+	if secs, ok := toFloat(findField(datum, fieldTimeSecs)); ok {
+		usecs, _ := toFloat(findField(datum, fieldTimeMicrosecs))
+		seg.time = time.Unix(int64(secs), int64(usecs)*int64(time.Microsecond))
+	}
+	return seg, true
+}
+
+// Returns the value of the first field with the given name found in a decoded
+// Avro datum, searching nested records and unions. Returns nil if not found.
+func findField(datum interface{}, name string) interface{} {
+	record, ok := datum.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if v, ok := record[name]; ok {
+		return v
+	}
+	for _, v := range record {
+		if found := findField(v, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Converts a decoded Avro number to float64. Unions are unwrapped.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case map[string]interface{}:
+		// Unions decode to a single entry keyed by the type name
+		for _, inner := range n {
+			return toFloat(inner)
+		}
+	}
+	return 0, false
+}
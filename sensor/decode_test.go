@@ -0,0 +1,203 @@
+package sensor
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const testSchemaFile = "testdata/sample.avsc"
+
+// Returns samples for two sweeps from 100 to 104 MHz in hops of 1 MHz, 16 bins
+// each, with a tone filling 102.25 to 102.5 MHz.
+func testSamples() []map[string]interface{} {
+	const bins = 16
+	start := time.Date(2022, 11, 13, 15, 20, 0, 0, time.UTC)
+
+	samples := []map[string]interface{}{}
+	for sweep := 0; sweep < 2; sweep++ {
+		for hop := 0; hop < 4; hop++ {
+			center := 100500000 + int64(hop)*1000000
+			mags := make([]float32, bins)
+			for i := range mags {
+				freq := float64(center) - 500000 + (float64(i)+0.5)*62500
+				mags[i] = 1e-10
+				if freq > 102250000 && freq < 102500000 {
+					mags[i] = 1e-4
+				}
+			}
+
+			t := start.Add(time.Duration(sweep*4+hop) * 100 * time.Millisecond)
+			samples = append(samples, map[string]interface{}{
+				"SenId": int64(1),
+				"SenConf": map[string]interface{}{
+					"HoppingStrategy":     int32(0),
+					"WindowingFunction":   int32(0),
+					"FFTSize":             int32(bins),
+					"AveragingFactor":     int32(5),
+					"FrequencyOverlap":    float32(0),
+					"FrequencyResolution": float32(62500),
+					"Gain":                float32(30),
+				},
+				"SenPos":  nil,
+				"SenTemp": goavro.Union("float", float32(40)),
+				"SenTime": map[string]interface{}{
+					"TimeSecs":      t.Unix(),
+					"TimeMicrosecs": int32(t.Nanosecond() / 1000),
+				},
+				"SenData": map[string]interface{}{
+					"CenterFreq": center,
+					"SquaredMag": mags,
+				},
+			})
+		}
+	}
+	return samples
+}
+
+func testCodec(t *testing.T) *goavro.Codec {
+	schema, err := os.ReadFile(testSchemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec
+}
+
+func TestScanCaptureAvro(t *testing.T) {
+	codec := testCodec(t)
+
+	datums := []byte{}
+	for _, s := range testSamples() {
+		var err error
+		datums, err = codec.BinaryFromNative(datums, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	container := &bytes.Buffer{}
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: container, Codec: codec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []interface{}{}
+	for _, s := range testSamples() {
+		samples = append(samples, s)
+	}
+	err = w.Append(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"datums":    datums,
+		"container": container.Bytes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			frames := []Frame{}
+			req := ScanRequest{FreqMin: 100000000, FreqMax: 104000000, FreqRes: 250000}
+			sc, err := newScanCapture(req, CommandFlags{SchemaFile: testSchemaFile}, func(f Frame) {
+				frames = append(frames, f)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sc.close()
+
+			// Datums split across reads must be reassembled
+			sc.receive(iotest.OneByteReader(bytes.NewReader(data)))
+
+			n, size, values := sc.result()
+			if n != 2 || len(frames) != 2 || size != int64(len(data)) || len(values) != 16 {
+				t.Fatalf("unexpected result: %d sweeps (%d frames), %d bytes, %d values", n, len(frames), size, len(values))
+			}
+			if !frames[1].Time.After(frames[0].Time) || frames[0].Time.Year() != 2022 {
+				t.Fatalf("sweeps must carry the time of the samples, got %s and %s", frames[0].Time, frames[1].Time)
+			}
+
+			peak := 0
+			for i, v := range values {
+				if v > values[peak] {
+					peak = i
+				}
+			}
+			if peak != 9 || math.Abs(values[peak]+40) > 0.1 || math.Abs(values[0]+100) > 0.1 {
+				t.Fatalf("expected a -40 dB tone in bin 9 over -100 dB, got %v", values)
+			}
+		})
+	}
+}
+
+func TestScanCaptureUnknown(t *testing.T) {
+	sc, err := newScanCapture(ScanRequest{FreqMin: 100000000, FreqMax: 104000000}, CommandFlags{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.close()
+
+	data := bytes.Repeat([]byte{0xff, 0x00}, 1000)
+	sc.receive(bytes.NewReader(data))
+
+	n, size, values := sc.result()
+	if n != 0 || size != int64(len(data)) || len(values) != 0 {
+		t.Fatalf("unknown data must only be counted, got %d sweeps, %d bytes, %v", n, size, values)
+	}
+}
+
+func TestScanCaptureFineResolution(t *testing.T) {
+	codec := testCodec(t)
+	data := []byte{}
+	for _, s := range testSamples() {
+		var err error
+		data, err = codec.BinaryFromNative(data, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Bins of 25 kHz are finer than the 62.5 kHz ones of the samples, so that some
+	// of them receive no values
+	frames := []Frame{}
+	req := ScanRequest{FreqMin: 100000000, FreqMax: 104000000, FreqRes: 25000}
+	sc, err := newScanCapture(req, CommandFlags{SchemaFile: testSchemaFile}, func(f Frame) {
+		frames = append(frames, f)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.close()
+
+	sc.receive(bytes.NewReader(data))
+
+	n, _, values := sc.result()
+	if n != 2 || len(frames) != 2 || len(values) != 160 {
+		t.Fatalf("unexpected result: %d sweeps (%d frames), %d values", n, len(frames), len(values))
+	}
+	for _, vs := range [][]float64{values, frames[0].Values, frames[1].Values} {
+		for k, v := range vs {
+			// The tone fills 102.25 to 102.5 MHz, bins 90 to 99
+			want := -100.0
+			if k >= 90 && k < 100 {
+				want = -40
+			}
+			if math.Abs(v-want) > 0.1 {
+				t.Fatalf("expected %.0f dB in bin %d, got %v", want, k, vs)
+			}
+		}
+	}
+
+	_, err = json.Marshal(ScanResult{Values: values})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,269 @@
+package sensor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/knadh/koanf"
+
+	"github.com/openrfsense/node/system"
+)
+
+// Name of the device used when none are configured.
+const defaultDeviceName = "default"
+
+// Type DeviceConfig describes an SDR device as found in the configuration under node.devices.
+type DeviceConfig struct {
+	// Unique name for the device
+	Name string `yaml:"name"`
+
+	// Index of the device as understood by the sensor program (see CommandFlags.DevIndex)
+	Index string `yaml:"index"`
+
+	// Hardware limits, defaults to node.limits
+	Limits Limits `yaml:"limits"`
+}
+
+// Type DeviceStatus reports the status of a single device.
+type DeviceStatus struct {
+	Name   string     `json:"name"`
+	Index  string     `json:"index,omitempty"`
+	Status StatusEnum `json:"status"`
+
+	// Current campaign ID (if running)
+	CampaignId string `json:"campaignId,omitempty"`
+
+	// IDs of the campaigns waiting to be started, in order
+	Scheduled []string `json:"scheduled,omitempty"`
+
+	Limits Limits `json:"limits"`
+
+	// How the last process run on the device ended, if any
+	LastRun *RunResult `json:"lastRun,omitempty"`
+}
+
+// Device managers, in configuration order
+var devices []*sensorManager
+
+// Whether campaigns are refused when no SDR device is attached
+var hardwareCheck bool
+
+// Returned (wrapped) when no SDR device is attached to the node.
+var ErrNoHardware = errors.New("no hardware")
+
+// Returned (wrapped) when the attached SDR devices cannot be listed, so whether
+// the campaign could run is not known.
+var ErrHardwareUnknown = errors.New("could not detect hardware")
+
+// Loads device configurations from node.devices. If no devices are configured,
+// a single device is described by node.sensor.devIndex and node.limits.
+func loadDevices(config *koanf.Koanf) ([]DeviceConfig, error) {
+	limits := Limits{}
+	err := config.UnmarshalWithConf("node.limits", &limits, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []DeviceConfig{}
+	err = config.UnmarshalWithConf("node.devices", &configs, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configs) == 0 {
+		return []DeviceConfig{{
+			Name:   defaultDeviceName,
+			Index:  DefaultFlags.DevIndex,
+			Limits: limits,
+		}}, nil
+	}
+
+	names := map[string]bool{}
+	for i, dc := range configs {
+		if strings.TrimSpace(dc.Name) == "" {
+			return nil, fmt.Errorf("device %d has no name", i)
+		}
+		if names[dc.Name] {
+			return nil, fmt.Errorf("device name %s is not unique", dc.Name)
+		}
+		names[dc.Name] = true
+
+		if dc.Limits == (Limits{}) {
+			configs[i].Limits = limits
+		}
+	}
+
+	return configs, nil
+}
+
+// Inserts the device name before the extension of a file path, so each device
+// gets its own file (queue.json becomes queue-name.json).
+func devicePath(path string, name string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// Schedules a campaign on the first device which supports its frequency range
+// and is free during its time window.
+func Schedule(c *Campaign) error {
+	if len(devices) == 0 {
+		return fmt.Errorf("no sensing devices available")
+	}
+
+	if hardwareCheck {
+		sdrs, err := system.ListSDRs()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrHardwareUnknown, err)
+		}
+		if len(sdrs) == 0 {
+			return fmt.Errorf("%w: no SDR device attached, cannot run campaign %s", ErrNoHardware, c.Id)
+		}
+	}
+
+	for _, m := range devices {
+		if m.has(c.Id) {
+			return fmt.Errorf("%w: campaign %s is already scheduled on device %s", ErrAlreadyScheduled, c.Id, m.name)
+		}
+	}
+
+	reasons := []string{}
+	for _, m := range devices {
+		err := m.schedule(c)
+		if err == nil {
+			return nil
+		}
+		// Invalid campaigns are invalid on all devices when there is only one
+		if len(devices) == 1 {
+			return err
+		}
+		reasons = append(reasons, fmt.Sprintf("%s: %v", m.name, err))
+	}
+
+	return fmt.Errorf("no device can run campaign %s (%s)", c.Id, strings.Join(reasons, "; "))
+}
+
+// Returns the command line the device which accepted the campaign will use to
+// run it (see Backend.CommandLine). When the watchdog meters the data sent to a
+// plain TCP collector, the collector address is replaced by a local relay when
+// the campaign starts (see RunResult.Command).
+func CommandLine(c *Campaign) ([]string, error) {
+	for _, m := range devices {
+		if m.name == c.Device {
+			return m.backend.CommandLine(c)
+		}
+	}
+
+	return nil, fmt.Errorf("%w %s", ErrUnknownCampaign, c.Id)
+}
+
+// Cancels a campaign: scheduled campaigns are removed from the queue, while the
+// running one is stopped with the same terminator used when reaching its end.
+func Cancel(id string) error {
+	for _, m := range devices {
+		err := m.cancel(id)
+		if !errors.Is(err, ErrUnknownCampaign) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w %s", ErrUnknownCampaign, id)
+}
+
+// Returns the campaigns waiting to be started on all devices, ordered by begin time.
+func Queue() []Campaign {
+	ret := []Campaign{}
+	for _, m := range devices {
+		m.RLock()
+		for _, c := range m.queue {
+			ret = append(ret, *c)
+		}
+		m.RUnlock()
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Begin.Before(ret[j].Begin)
+	})
+	return ret
+}
+
+// Returns the buffered output lines for the given campaign, which must be the
+// current or the last one on its device.
+func Log(campaignId string) ([]Line, error) {
+	for _, m := range devices {
+		m.RLock()
+		tail := m.tail
+		m.RUnlock()
+
+		if tail != nil && tail.campaignId == campaignId {
+			return tail.Lines(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w %s", ErrUnknownCampaign, campaignId)
+}
+
+// Returns the ID of the first running campaign (assigned by the backend).
+func CampaignId() string {
+	for _, m := range devices {
+		m.RLock()
+		current := m.current
+		m.RUnlock()
+
+		if current != nil {
+			return current.Id
+		}
+	}
+
+	return ""
+}
+
+// Returns the overall status of the sensor managers: busy if any device is
+// running a campaign, then scheduled, error or free in this order.
+func Status() StatusEnum {
+	found := map[StatusEnum]bool{}
+	for _, m := range devices {
+		m.RLock()
+		found[m.status] = true
+		m.RUnlock()
+	}
+
+	for _, status := range []StatusEnum{Busy, Scheduled, Error} {
+		if found[status] {
+			return status
+		}
+	}
+	return Free
+}
+
+// Returns the status of every device, in configuration order.
+func Devices() []DeviceStatus {
+	ret := make([]DeviceStatus, 0, len(devices))
+	for _, m := range devices {
+		m.RLock()
+		ds := DeviceStatus{
+			Name:      m.name,
+			Index:     m.index,
+			Status:    m.status,
+			Scheduled: []string{},
+			Limits:    m.limits,
+			LastRun:   m.last,
+		}
+		if m.current != nil {
+			ds.CampaignId = m.current.Id
+		}
+		for _, c := range m.queue {
+			ds.Scheduled = append(ds.Scheduled, c.Id)
+		}
+		m.RUnlock()
+
+		ret = append(ret, ds)
+	}
+
+	return ret
+}
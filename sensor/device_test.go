@@ -0,0 +1,69 @@
+package sensor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRouting(t *testing.T) {
+	rtl := newTestManager()
+	rtl.name = "rtl"
+	rtl.index = "0"
+	rtl.limits = Limits{MinFreq: 24000000, MaxFreq: 1766000000}
+
+	hackrf := newTestManager()
+	hackrf.name = "hackrf"
+	hackrf.index = "1"
+	hackrf.limits = Limits{MinFreq: 1000000, MaxFreq: 6000000000}
+
+	devices = []*sensorManager{rtl, hackrf}
+	defer func() { devices = nil }()
+
+	now := time.Now()
+	campaign := func(id string, freq int64) *Campaign {
+		return &Campaign{Id: id, Begin: now.Add(time.Hour), End: now.Add(2 * time.Hour), FreqMin: freq, FreqMax: freq}
+	}
+
+	t.Run("frequency range", func(t *testing.T) {
+		c := campaign("wifi", 2400000000)
+		if err := Schedule(c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Device != "hackrf" || c.Flags.DevIndex != "1" {
+			t.Fatalf("expected campaign on hackrf (1), got %s (%s)", c.Device, c.Flags.DevIndex)
+		}
+	})
+
+	t.Run("busy device", func(t *testing.T) {
+		c := campaign("fm", 100000000)
+		if err := Schedule(c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Device != "rtl" {
+			t.Fatalf("expected campaign on rtl, got %s", c.Device)
+		}
+
+		// The RTL-SDR is busy, the HackRF is busy too
+		if err := Schedule(campaign("fm2", 100000000)); err == nil {
+			t.Fatal("expected campaign to be rejected")
+		}
+	})
+
+	t.Run("duplicate ID", func(t *testing.T) {
+		c := campaign("wifi", 100000000)
+		c.Begin = now.Add(5 * time.Hour)
+		c.End = now.Add(6 * time.Hour)
+		if err := Schedule(c); err == nil {
+			t.Fatal("campaigns with the same ID must be refused on all devices")
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		if Status() != Scheduled {
+			t.Fatalf("expected status %s, got %s", Scheduled, Status())
+		}
+		if len(Devices()) != 2 || len(Queue()) != 2 {
+			t.Fatalf("expected 2 devices and 2 campaigns, got %d and %d", len(Devices()), len(Queue()))
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package sensor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Number of stderr lines attached to a RunError.
+const errorTailLines = 20
+
+// Type ErrorCode classifies errors reported by the sensor manager.
+type ErrorCode string
+
+const (
+	// The process could not be started
+	CodeStartFailed ErrorCode = "START_FAILED"
+
+	// The process could not be terminated when required
+	CodeTerminateFailed ErrorCode = "TERMINATE_FAILED"
+
+	// The process exited with a non-zero exit code
+	CodeExitFailure ErrorCode = "EXIT_FAILURE"
+
+	// The process was terminated by a signal it didn't handle
+	CodeSignaled ErrorCode = "SIGNALED"
+
+	// The process made no progress and was killed by the watchdog
+	CodeStalled ErrorCode = "STALLED"
+)
+
+// Type RunError describes a failed sensor run, with enough context for the
+// backend to tell what went wrong.
+type RunError struct {
+	Code       ErrorCode
+	CampaignId string
+
+	// Exit code of the process, -1 if it did not exit or was killed by a signal
+	ExitCode int
+
+	// Name of the signal which terminated the process, if any
+	Signal string
+
+	// Last lines written by the process on stderr
+	Stderr []string
+
+	Time time.Time
+
+	err error
+}
+
+// Creates a RunError for the given campaign, filling in exit information if
+// err comes from exec.Cmd.Wait.
+func newRunError(code ErrorCode, c *Campaign, err error, tail *outputLog) *RunError {
+	exitCode, signal := exitStatus(err)
+	re := &RunError{
+		Code:       code,
+		CampaignId: c.Id,
+		ExitCode:   exitCode,
+		Signal:     signal,
+		Stderr:     []string{},
+		Time:       time.Now(),
+		err:        err,
+	}
+
+	if tail != nil {
+		for _, l := range tail.Lines() {
+			if l.Stream == "stderr" {
+				re.Stderr = append(re.Stderr, l.Text)
+			}
+		}
+		if len(re.Stderr) > errorTailLines {
+			re.Stderr = re.Stderr[len(re.Stderr)-errorTailLines:]
+		}
+	}
+
+	return re
+}
+
+func (re *RunError) Error() string {
+	return fmt.Sprintf("campaign %s: %v", re.CampaignId, re.err)
+}
+
+func (re *RunError) Unwrap() error {
+	return re.err
+}
+
+// Returns the exit code and the name of the terminating signal (if any) of a
+// process, given the error returned by exec.Cmd.Wait. The exit code is -1 if
+// the process did not exit normally.
+func exitStatus(err error) (int, string) {
+	if err == nil {
+		return 0, ""
+	}
+
+	exitErr := &exec.ExitError{}
+	if !errors.As(err, &exitErr) {
+		return -1, ""
+	}
+
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return -1, ws.Signal().String()
+	}
+	return exitErr.ExitCode(), ""
+}
@@ -0,0 +1,24 @@
+package sensor
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestExitStatus(t *testing.T) {
+	t.Run("exit code", func(t *testing.T) {
+		err := exec.Command("sh", "-c", "exit 3").Run()
+		code, signal := exitStatus(err)
+		if code != 3 || signal != "" {
+			t.Fatalf("expected exit code 3 and no signal, got %d and %q", code, signal)
+		}
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		err := exec.Command("sh", "-c", "kill -TERM $$").Run()
+		code, signal := exitStatus(err)
+		if code != -1 || signal != "terminated" {
+			t.Fatalf("expected exit code -1 and signal terminated, got %d and %q", code, signal)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package sensor
+
+import (
+	"sync"
+	"time"
+)
+
+// Type EventType describes what happened to a campaign on a device.
+type EventType string
+
+const (
+	// The campaign was queued on the device
+	EventAccepted EventType = "ACCEPTED"
+
+	// The sensor process was started
+	EventStarted EventType = "STARTED"
+
+	// The sensor process ended without errors
+	EventFinished EventType = "FINISHED"
+
+	// The campaign could not be run, or its process failed
+	EventFailed EventType = "FAILED"
+
+	// The campaign was cancelled, while running or queued
+	EventCancelled EventType = "CANCELLED"
+)
+
+// Type Event reports a change in the state of a device caused by a campaign.
+type Event struct {
+	Type       EventType `json:"type"`
+	CampaignId string    `json:"campaignId"`
+	Device     string    `json:"device"`
+
+	// Status of the device before and after the event
+	From StatusEnum `json:"from"`
+	To   StatusEnum `json:"to"`
+
+	// Why the campaign failed, if it did
+	Reason string `json:"reason,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// Type eventBus delivers events to any number of subscribers. Events are dropped
+// for subscribers which do not keep up, so that devices are never blocked.
+type eventBus struct {
+	subscribers map[chan Event]struct{}
+	sync.Mutex
+}
+
+// Events of all device managers
+var events = &eventBus{subscribers: map[chan Event]struct{}{}}
+
+// Sends an event to every subscriber.
+func (b *eventBus) publish(e Event) {
+	b.Lock()
+	defer b.Unlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub <- e:
+		default:
+			log.Debugf("dropped %s event for campaign %s, subscriber is too slow", e.Type, e.CampaignId)
+		}
+	}
+}
+
+// Registers a subscriber with a buffer of the given size. The returned function
+// removes it and closes its channel.
+func (b *eventBus) subscribe(size int) (<-chan Event, func()) {
+	sub := make(chan Event, size)
+
+	b.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.Unlock()
+
+	var once sync.Once
+	return sub, func() {
+		once.Do(func() {
+			b.Lock()
+			delete(b.subscribers, sub)
+			close(sub)
+			b.Unlock()
+		})
+	}
+}
+
+// Publishes an event for a campaign, the device status after the event being the
+// current one. Must be called with the lock held.
+func (m *sensorManager) emit(t EventType, c *Campaign, from StatusEnum, reason string) {
+	events.publish(Event{
+		Type:       t,
+		CampaignId: c.Id,
+		Device:     m.name,
+		From:       from,
+		To:         m.status,
+		Reason:     reason,
+		Time:       time.Now(),
+	})
+}
+
+// Subscribes to the events of all devices, with a buffer of the given size. The
+// returned function must be called to unsubscribe, and closes the channel.
+func Events(size int) (<-chan Event, func()) {
+	return events.subscribe(size)
+}
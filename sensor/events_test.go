@@ -0,0 +1,57 @@
+package sensor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	sub, unsubscribe := Events(10)
+
+	m := newTestManager()
+	m.name = "sdr0"
+	m.err = make(chan error, 10)
+	m.output = make(chan RunOutput, 10)
+
+	now := time.Now()
+	_ = m.schedule(&Campaign{Id: "queued", Begin: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	_ = m.unschedule("queued")
+
+	for _, script := range []string{"exit 0", "exit 3", "true"} {
+		backend, err := newTemplateBackend("sh", []string{"-c", script})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.backend = backend
+		m.run(&Campaign{Id: script, Begin: time.Now(), End: time.Now().Add(5 * time.Second)})
+	}
+
+	unsubscribe()
+	got := []Event{}
+	for e := range sub {
+		got = append(got, e)
+	}
+
+	want := []Event{
+		{Type: EventAccepted, CampaignId: "queued", From: Free, To: Scheduled},
+		{Type: EventCancelled, CampaignId: "queued", From: Scheduled, To: Free},
+		{Type: EventStarted, CampaignId: "exit 0", From: Free, To: Busy},
+		{Type: EventFinished, CampaignId: "exit 0", From: Busy, To: Free},
+		{Type: EventStarted, CampaignId: "exit 3", From: Free, To: Busy},
+		{Type: EventFailed, CampaignId: "exit 3", From: Busy, To: Error},
+		{Type: EventStarted, CampaignId: "true", From: Error, To: Busy},
+		{Type: EventFinished, CampaignId: "true", From: Busy, To: Free},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), got)
+	}
+	for i, e := range got {
+		w := want[i]
+		if e.Type != w.Type || e.CampaignId != w.CampaignId || e.From != w.From || e.To != w.To || e.Device != "sdr0" || e.Time.IsZero() {
+			t.Fatalf("event %d: expected %+v, got %+v", i, w, e)
+		}
+		if (e.Type == EventFailed) != (e.Reason != "") {
+			t.Fatalf("event %d: unexpected reason %q", i, e.Reason)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package sensor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Maximum number of records kept in the history, oldest ones are dropped first.
+const maxHistory = 1000
+
+// Type Outcome describes how a campaign ended.
+type Outcome string
+
+const (
+	// The process exited successfully or was stopped at the end of the campaign
+	OutcomeDone Outcome = "DONE"
+
+	// The process could not be started or exited unsuccessfully
+	OutcomeFailed Outcome = "FAILED"
+
+	// The campaign was stopped early on request
+	OutcomeCancelled Outcome = "CANCELLED"
+
+	// The process made no progress and was killed by the watchdog
+	OutcomeStalled Outcome = "STALLED"
+)
+
+// Type Record describes a campaign run by the node, as stored in the history.
+type Record struct {
+	Id      string    `json:"id"`
+	Type    string    `json:"type"`
+	FreqMin int64     `json:"freqMin"`
+	FreqMax int64     `json:"freqMax"`
+	Begin   time.Time `json:"begin"`
+	End     time.Time `json:"end"`
+
+	// Names of the device and backend which ran the campaign
+	Device  string `json:"device"`
+	Backend string `json:"backend"`
+
+	Outcome Outcome `json:"outcome"`
+
+	// Exit code of the process, -1 if it did not exit normally
+	ExitCode int `json:"exitCode"`
+
+	// Number of the attempt at running the campaign, starting from 1
+	Attempt int `json:"attempt"`
+
+	// Actual start time and run time of the process, in seconds
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"duration"`
+
+	// Bytes written by the process on stdout and stderr
+	OutputSize int64 `json:"outputSize"`
+
+	// How the process ended, null if it could not be started
+	Result *RunResult `json:"result,omitempty"`
+}
+
+// Type history is a file-backed list of campaign records, oldest first.
+type history struct {
+	path    string
+	records []Record
+
+	sync.RWMutex
+}
+
+var campaignHistory = &history{}
+
+// Loads the history from the given file. An empty path keeps the history in
+// memory only.
+func loadHistory(path string) (*history, error) {
+	h := &history{
+		path:    path,
+		records: []Record{},
+	}
+	if path == "" {
+		return h, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &h.records)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not parse campaign history %s", err, path)
+	}
+
+	return h, nil
+}
+
+// Appends a record and saves the history to disk.
+func (h *history) add(r Record) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.records = append(h.records, r)
+	if len(h.records) > maxHistory {
+		h.records = h.records[len(h.records)-maxHistory:]
+	}
+
+	if h.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(h.records)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	// Write to a temporary file first so the history is never left half-written
+	tmp := h.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err == nil {
+		err = os.Rename(tmp, h.path)
+	}
+	if err != nil {
+		log.Errorf("%v: could not save campaign history", err)
+	}
+}
+
+// Adds the record of a run of the campaign to the history, unless the campaign
+// is local. The outcome is kept in the campaign either way.
+func addRecord(c *Campaign, r Record) {
+	c.outcome = r.Outcome
+	if !c.local {
+		campaignHistory.add(r)
+	}
+}
+
+// Returns a copy of all the records, most recent first.
+func (h *history) list() []Record {
+	h.RLock()
+	defer h.RUnlock()
+
+	ret := make([]Record, 0, len(h.records))
+	for i := len(h.records) - 1; i >= 0; i-- {
+		ret = append(ret, h.records[i])
+	}
+	return ret
+}
+
+// Returns the records of all the campaigns run by the node, most recent first.
+func History() []Record {
+	return campaignHistory.list()
+}
@@ -0,0 +1,45 @@
+package sensor
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	t.Run("persistence", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.json")
+
+		h, err := loadHistory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.add(Record{Id: "a", Outcome: OutcomeDone})
+		h.add(Record{Id: "b", Outcome: OutcomeFailed})
+
+		restored, err := loadHistory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		records := restored.list()
+		if len(records) != 2 || records[0].Id != "b" || records[1].Id != "a" {
+			t.Fatalf("history was not restored correctly: %v", records)
+		}
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		h, _ := loadHistory("")
+		for i := 0; i < maxHistory+10; i++ {
+			h.add(Record{Id: fmt.Sprint(i)})
+		}
+
+		records := h.list()
+		if len(records) != maxHistory {
+			t.Fatalf("expected %d records, got %d", maxHistory, len(records))
+		}
+		if records[len(records)-1].Id != "10" {
+			t.Fatalf("expected the oldest records to be dropped, got %s", records[len(records)-1].Id)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package sensor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// First argument (argv[0]) given to the node when started as a launcher.
+const launcherArg = "openrfsense-launcher"
+
+// The running node executable, even if replaced on disk in the meantime.
+const launcherPath = "/proc/self/exe"
+
+// Type launchSpec describes the limits applied by the launcher before executing
+// the sensor process.
+type launchSpec struct {
+	Nice   int `json:"nice,omitempty"`
+	IOPrio int `json:"ioprio,omitempty"`
+
+	// Address space limit in bytes, used when cgroup v2 is not available
+	Memory uint64 `json:"memory,omitempty"`
+
+	// Cgroup the process is moved into, already set up with its limits
+	Cgroup string `json:"cgroup,omitempty"`
+
+	Credential *syscall.Credential `json:"credential,omitempty"`
+	Dir        string              `json:"dir,omitempty"`
+}
+
+// Applies the limits and executes the sensor process if the node was started as
+// a launcher by a sensor backend, otherwise returns right away. Must be called
+// at the very beginning of main.
+//
+// The launcher is needed because the process must not run before it is in its
+// cgroup and has its priorities set, while these cannot be set by exec.Cmd.
+func RunLauncher() {
+	if len(os.Args) < 4 || os.Args[0] != launcherArg {
+		return
+	}
+
+	err := launch(os.Args[1], os.Args[2], os.Args[3:])
+	fmt.Fprintf(os.Stderr, "%s: %v\n", launcherArg, err)
+	os.Exit(127)
+}
+
+// Applies the limits described by spec (JSON encoded) to the current process and
+// executes path with the given arguments. Limits which cannot be applied are
+// reported on stderr, along with the output of the process, except for the
+// credentials, the working directory and the memory limit. Only returns on
+// failure.
+func launch(encoded string, path string, args []string) error {
+	// Priorities are set for the calling thread only, which is the one which
+	// survives exec
+	runtime.LockOSThread()
+
+	spec := launchSpec{}
+	err := json.Unmarshal([]byte(encoded), &spec)
+	if err != nil {
+		return err
+	}
+
+	warn := func(err error, what string) {
+		fmt.Fprintf(os.Stderr, "%s: %v: could not set %s\n", launcherArg, err, what)
+	}
+
+	if spec.Cgroup != "" {
+		err := os.WriteFile(filepath.Join(spec.Cgroup, "cgroup.procs"), []byte("0"), 0o644)
+		if err != nil {
+			warn(err, "cgroup")
+		}
+	}
+	if spec.Nice != 0 {
+		err := unix.Setpriority(unix.PRIO_PROCESS, 0, spec.Nice)
+		if err != nil {
+			warn(err, "nice value")
+		}
+	}
+	if spec.IOPrio != 0 {
+		_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, 1, 0, uintptr(spec.IOPrio))
+		if errno != 0 {
+			warn(errno, "I/O priority")
+		}
+	}
+
+	// Privileges are dropped last, since the limits above may need them
+	if cred := spec.Credential; cred != nil {
+		groups := make([]int, 0, len(cred.Groups))
+		for _, g := range cred.Groups {
+			groups = append(groups, int(g))
+		}
+		err := unix.Setgroups(groups)
+		if err != nil {
+			return err
+		}
+		err = unix.Setgid(int(cred.Gid))
+		if err != nil {
+			return err
+		}
+		err = unix.Setuid(int(cred.Uid))
+		if err != nil {
+			return err
+		}
+	}
+
+	if spec.Dir != "" {
+		err := os.Chdir(spec.Dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return execLimited(path, args, os.Environ(), spec.Memory)
+}
+
+// Executes path with the given arguments and environment, limiting the address
+// space to memory bytes (if not 0) right before. Everything is allocated before
+// the limit is set, since the runtime cannot map more memory after that and
+// would die with an out of memory error. Only returns on failure.
+func execLimited(path string, args []string, env []string, memory uint64) error {
+	pathp, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	argvp, err := syscall.SlicePtrFromStrings(args)
+	if err != nil {
+		return err
+	}
+	envvp, err := syscall.SlicePtrFromStrings(env)
+	if err != nil {
+		return err
+	}
+	limit := &unix.Rlimit{Cur: memory, Max: memory}
+
+	if memory > 0 {
+		_, _, errno := unix.RawSyscall6(unix.SYS_PRLIMIT64, 0, unix.RLIMIT_AS, uintptr(unsafe.Pointer(limit)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("%w: could not set memory limit", errno)
+		}
+	}
+
+	_, _, errno := unix.RawSyscall(unix.SYS_EXECVE,
+		uintptr(unsafe.Pointer(pathp)),
+		uintptr(unsafe.Pointer(&argvp[0])),
+		uintptr(unsafe.Pointer(&envvp[0])))
+	return errno
+}
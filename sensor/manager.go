@@ -1,18 +1,17 @@
 package sensor
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os/exec"
 	"strconv"
+	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/openrfsense/common/logging"
 	"github.com/openrfsense/common/types"
-	"github.com/openrfsense/node/system"
 
 	"github.com/knadh/koanf"
 )
@@ -23,218 +22,512 @@ const afterTermTimeout = time.Second
 type StatusEnum string
 
 const (
-	Free  StatusEnum = "FREE"
-	Busy  StatusEnum = "BUSY"
-	Error StatusEnum = "ERROR"
+	Free      StatusEnum = "FREE"
+	Scheduled StatusEnum = "SCHEDULED"
+	Busy      StatusEnum = "BUSY"
+	Error     StatusEnum = "ERROR"
 )
 
-// Type sensorManager holds the necessary information to manage an es_sensor
+// Type sensorManager holds the necessary information to manage a sensor
 // process and run a campaign, reporting eventual errors and command output
 type sensorManager struct {
+	// Name of the device managed, as found in the configuration
+	name string
+
+	// Index of the device, passed to the sensor process (see CommandFlags.DevIndex)
+	index string
+
 	// General sensing status
 	status StatusEnum
 
-	// Current campaign ID (if running) or empty (if free)
-	campaignId string
+	// Current campaign (if running) or nil (if free)
+	current *Campaign
+
+	// Stops the current campaign before its end, if running
+	stop context.CancelFunc
+
+	// Campaigns waiting to be started, ordered by begin time
+	queue []*Campaign
+
+	// Path of the file where the queue is saved, if any
+	queuePath string
+
+	// Used to notify the scheduler of changes to the queue
+	wake chan struct{}
+
+	// Program used to run campaigns
+	backend Backend
 
-	// Campaign start datetime
-	begin time.Time
+	// Hardware limits campaigns are validated against
+	limits Limits
 
-	// Campaign end datetime
-	end time.Time
+	// Last command output, if any. Only the lines kept in the output log are sent
+	output chan RunOutput
 
-	// Flags to pass onto the es-sensor process
-	flags CommandFlags
+	// Result of the last process run, if any
+	last *RunResult
 
-	// Last command output, if any
-	output chan string
+	// Output log of the current or last campaign
+	tail *outputLog
+
+	// Lines of command output, streamed while the process runs
+	lines chan Line
+
+	// Number of lines kept in the output log and lines per second sent on the lines channel
+	outputSize int
+	outputRate float64
 
 	// Last command error, if any
 	err chan error
 
+	// IDs of the campaigns stopped early, sent after the process has exited
+	cancelled chan string
+
+	// How failed campaigns are retried
+	policy RetryPolicy
+
+	// Failed attempts at running campaigns
+	retries chan Attempt
+
+	// Processes which make no progress for this long are killed, 0 disables the watchdog
+	watchdog time.Duration
+
+	// Campaigns killed by the watchdog
+	stalled chan Stall
+
 	sync.RWMutex
 }
 
-var manager *sensorManager
+// Channels shared by all device managers
+var (
+	outputChan    = make(chan RunOutput, 1)
+	errChan       = make(chan error, 1)
+	cancelledChan = make(chan string, 1)
+	linesChan     = make(chan Line, 64)
+	retriesChan   = make(chan Attempt, 1)
+	stalledChan   = make(chan Stall, 1)
+)
+
+// Default flags for all campaigns, including the collector address
+var baseFlags CommandFlags
 
 var log = logging.New().
 	WithPrefix("sensor").
 	WithLevel(logging.DebugLevel).
 	WithFlags(logging.FlagsDevelopment)
 
-// Starts the actual process.
-func (m *sensorManager) Run() {
-	m.RLock()
-	if m.status == Busy {
-		m.RUnlock()
-		log.Warn("Sensor is busy, not taking part in the campaign")
-		return
-	}
-	m.RUnlock()
+// Starts the actual process for the given campaign. Blocking.
+func (m *sensorManager) run(c *Campaign) {
+	defer c.finish()
 
-	m.flags.CampaignId = m.campaignId
-	m.flags.SensorId = system.ID()
-	flagsSlice := generateFlags(m.flags)
+	ctx, cancel := context.WithDeadline(context.Background(), c.End)
+	defer cancel()
 
-	log.Debugf("starting manager: %#v", m)
+	// Output is streamed line by line while the process runs, only to whoever
+	// started the campaign if it is local
+	lines := m.lines
+	if c.local {
+		lines = nil
+	}
+	tail := newOutputLog(c.Id, m.outputSize, m.outputRate, lines)
 
+	m.Lock()
+	m.current = c
+	m.stop = cancel
+	m.tail = tail
+	from := m.status
 	m.status = Busy
-	// time.Sleep(time.Until(m.begin))
-	log.Debugf("starting campaign %s", m.campaignId)
+	m.emit(EventStarted, c, from, "")
+	m.Unlock()
+	log.Debugf("starting campaign %s with backend %s", c.Id, m.backend.Name())
+
+	stdout := tail.writer("stdout")
+	stderr := tail.writer("stderr")
+
+	started := time.Now()
+	record := Record{
+		Id:       c.Id,
+		Type:     c.Type,
+		FreqMin:  c.FreqMin,
+		FreqMax:  c.FreqMax,
+		Begin:    c.Begin,
+		End:      c.End,
+		Device:   m.name,
+		Backend:  m.backend.Name(),
+		Outcome:  OutcomeDone,
+		ExitCode: -1,
+		Started:  started,
+		Attempt:  c.Attempt + 1,
+	}
 
-	ctx, cancel := context.WithDeadline(context.Background(), m.end)
-	defer cancel()
-	cmd := exec.Command(m.flags.Command, flagsSlice...)
-	log.Debug(cmd.String())
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
-	cmd.Stderr = &buf
+	// Data sent to the collector is metered for the watchdog, if possible (the
+	// trailing # means plain TCP, TLS connections can't be relayed)
+	var mt *meter
+	launched := c
+	if m.watchdog > 0 && strings.HasSuffix(c.Flags.SslCollector, "#") {
+		var err error
+		mt, err = newMeter(strings.TrimSuffix(c.Flags.SslCollector, "#"))
+		if err != nil {
+			log.Warnf("%v: could not meter data sent to the collector", err)
+		} else {
+			defer mt.close()
+			metered := *c
+			metered.Flags.SslCollector = mt.addr() + "#"
+			launched = &metered
+		}
+	}
 
-	err := cmd.Start()
+	command, err := m.backend.CommandLine(launched)
 	if err != nil {
-		m.err <- err
+		log.Warnf("%v: could not generate command line for campaign %s", err, c.Id)
+	}
+
+	proc, err := m.backend.Start(launched, stdout, stderr)
+	if err != nil {
+		record.Outcome = OutcomeFailed
+		addRecord(c, record)
+		runErr := newRunError(CodeStartFailed, c, err, nil)
+		log.Error(runErr)
+		if !c.local {
+			m.err <- runErr
+		}
 		m.Lock()
+		m.current = nil
+		m.stop = nil
 		m.status = Error
+		m.emit(EventFailed, c, Busy, runErr.Error())
 		m.Unlock()
+		m.retry(c, runErr)
 		return
 	}
+
 	// A custom process terminator is needed because the stanadrd library's CommandContext
 	// kills the process leaving thousands of TCP sockets open
 	waitDone := make(chan struct{})
+	var terminated, killed int32
 	go func() {
 		select {
 		case <-ctx.Done():
-			err := cmd.Process.Signal(syscall.SIGTERM)
+			// The context is also cancelled once the campaign is over, the
+			// process must not be terminated if it already exited
+			select {
+			case <-waitDone:
+				return
+			default:
+			}
+			atomic.StoreInt32(&terminated, 1)
+			err := proc.Terminate()
 			if err != nil {
-				m.err <- err
+				runErr := newRunError(CodeTerminateFailed, c, err, tail)
+				if c.local {
+					log.Error(runErr)
+				} else {
+					m.err <- runErr
+				}
 				m.Lock()
+				from := m.status
 				m.status = Error
+				m.emit(EventFailed, c, from, runErr.Error())
 				m.Unlock()
 				return
 			}
 			select {
 			case <-time.After(afterTermTimeout):
-				_ = cmd.Process.Kill()
+				atomic.StoreInt32(&killed, 1)
+				_ = proc.Kill()
 			case <-waitDone:
 			}
 		case <-waitDone:
 		}
 	}()
 
-	err = cmd.Wait()
+	stalled := make(chan bool, 1)
+	if m.watchdog > 0 {
+		go func() {
+			stalled <- m.watch(c, proc, tail, mt, waitDone)
+		}()
+	} else {
+		stalled <- false
+	}
+
+	err = proc.Wait()
 	close(waitDone)
-	log.Debug(string(buf.String()))
-	m.output <- string(buf.String())
+	stdout.Flush()
+	stderr.Flush()
+
+	// The process was terminated on request or at the end of the campaign, so
+	// its exit status is expected
+	stopped := errors.Is(ctx.Err(), context.Canceled)
+	result := newRunResult(
+		c, proc, err, started,
+		stopped,
+		atomic.LoadInt32(&terminated) == 1,
+		atomic.LoadInt32(&killed) == 1,
+		<-stalled,
+	)
+	result.Command = command
+
+	if !c.local {
+		output := []string{}
+		for _, l := range tail.Lines() {
+			output = append(output, l.Text)
+		}
+		m.output <- RunOutput{
+			Result: result,
+			Output: strings.Join(output, "\n"),
+		}
+	}
 
+	record.ExitCode = result.ExitCode
+	record.Duration = result.WallTime
+	record.OutputSize = tail.Size()
+	record.Result = &result
+
+	var runErr *RunError
+	switch result.Reason {
+	case ReasonCancelled:
+		record.Outcome = OutcomeCancelled
+	case ReasonStalled:
+		record.Outcome = OutcomeStalled
+		runErr = newRunError(CodeStalled, c, err, tail)
+	case ReasonCrashed:
+		record.Outcome = OutcomeFailed
+		runErr = newRunError(CodeSignaled, c, err, tail)
+	case ReasonExited:
+		if err != nil {
+			record.Outcome = OutcomeFailed
+			runErr = newRunError(CodeExitFailure, c, err, tail)
+		}
+	}
+	if runErr != nil {
+		log.Error(runErr)
+		if !c.local {
+			m.err <- runErr
+		}
+	}
+	addRecord(c, record)
+
+	// Failed campaigns leave the manager in error until they are retried or the
+	// next campaign starts
 	m.Lock()
-	m.campaignId = ""
-	if err != nil {
-		log.Error(err)
-		m.err <- err
+	m.current = nil
+	m.stop = nil
+	m.last = &result
+	from = m.status
+	if runErr != nil || from == Error {
 		m.status = Error
 	} else {
 		m.status = Free
+		m.settle()
+	}
+	switch {
+	case runErr != nil:
+		m.emit(EventFailed, c, from, runErr.Error())
+	case stopped:
+		m.emit(EventCancelled, c, from, "")
+	default:
+		m.emit(EventFinished, c, from, "")
 	}
 	m.Unlock()
+
+	if runErr != nil {
+		m.retry(c, runErr)
+	}
+
+	if stopped {
+		log.Infof("campaign %s was cancelled", c.Id)
+		if !c.local {
+			m.cancelled <- c.Id
+		}
+	}
+}
+
+// Stops the campaign with the given ID: running campaigns are terminated, while
+// scheduled ones are removed from the queue.
+func (m *sensorManager) cancel(id string) error {
+	m.RLock()
+	if m.current != nil && m.current.Id == id {
+		stop := m.stop
+		m.RUnlock()
+		stop()
+		return nil
+	}
+	m.RUnlock()
+
+	return m.unschedule(id)
 }
 
-// Open channel where command output is sent after completion.
-func Output() <-chan string {
-	return manager.output
+// Open channel where the result and the last lines of output of each process
+// are sent after completion.
+func Output() <-chan RunOutput {
+	return outputChan
 }
 
 // Open channel where command errors are sent after completion.
 func Err() <-chan error {
-	return manager.err
+	return errChan
 }
 
-// Returns the current campaign ID (assigned by the backend).
-func CampaignId() string {
-	manager.RLock()
-	defer manager.RUnlock()
-	return manager.campaignId
+// Open channel where lines of command output are sent as soon as they are read.
+func Lines() <-chan Line {
+	return linesChan
 }
 
-// Returns the current status of the sensor manager.
-func Status() StatusEnum {
-	manager.RLock()
-	defer manager.RUnlock()
-	return manager.status
+// Open channel where the IDs of cancelled campaigns are sent after the process has exited.
+func Cancelled() <-chan string {
+	return cancelledChan
 }
 
-// Initializes a SensorManager singleton. Also loads default command line flags
-// from the configuration.
+// Initializes a sensor manager for each device described in the configuration
+// under node.devices, or a single one if no devices are configured. Also loads
+// default command line flags from the configuration.
 func Init(config *koanf.Koanf) error {
 	err := config.Unmarshal("node.sensor", &DefaultFlags)
 	if err != nil {
 		return err
 	}
 
-	if manager == nil {
-		manager = &sensorManager{
-			flags:      DefaultFlags,
-			status:     Free,
-			campaignId: "",
-			output:     make(chan string, 1),
-			err:        make(chan error, 1),
-		}
+	backend, err := newBackend(config)
+	if err != nil {
+		return err
+	}
+
+	isolation, err = newProcessIsolation(config)
+	if err != nil {
+		return err
 	}
 
-	// Initialize TCP collector to the one described in the configuration
-	manager.flags.SslCollector = fmt.Sprintf(
+	// Simulated campaigns don't need any hardware
+	hardwareCheck = config.Bool("node.hardwareCheck") && backend.Name() != simulatedBackendName
+
+	setAllowedOverrides(config.Strings("node.overrides"))
+	profiles, err = loadProfiles(config)
+	if err != nil {
+		return err
+	}
+
+	campaignHistory, err = loadHistory(config.String("node.history"))
+	if err != nil {
+		return err
+	}
+
+	// Initialize TCP collector to the one described in the configuration, or
+	// to the local spool which forwards data to it
+	baseFlags = DefaultFlags
+	baseFlags.SslCollector = fmt.Sprintf(
 		"%s:%d#",
 		config.String("collector.host"),
 		config.MustInt("collector.port"),
 	)
+	if config.Bool("node.spool.enabled") {
+		baseFlags.SslCollector = fmt.Sprintf("127.0.0.1:%d#", config.MustInt("node.spool.port"))
+	}
+
+	if devices != nil {
+		return nil
+	}
+
+	policy := RetryPolicy{}
+	err = config.UnmarshalWithConf("node.retry", &policy, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return err
+	}
+
+	configs, err := loadDevices(config)
+	if err != nil {
+		return err
+	}
+
+	for _, dc := range configs {
+		m := &sensorManager{
+			name:      dc.Name,
+			index:     dc.Index,
+			backend:   backend,
+			limits:    dc.Limits,
+			status:    Free,
+			wake:      make(chan struct{}, 1),
+			output:    outputChan,
+			err:       errChan,
+			cancelled: cancelledChan,
+			lines:     linesChan,
+			retries:   retriesChan,
+			policy:    policy,
+			stalled:   stalledChan,
+			watchdog:  time.Duration(config.Int64("node.watchdog")) * time.Second,
+
+			outputSize: config.Int("node.output.buffer"),
+			outputRate: config.Float64("node.output.rate"),
+		}
+
+		queuePath := config.String("node.queue")
+		if len(configs) > 1 {
+			queuePath = devicePath(queuePath, dc.Name)
+		}
+		err = m.load(queuePath)
+		if err != nil {
+			return err
+		}
+
+		devices = append(devices, m)
+		go m.scheduler()
+	}
 
 	return nil
 }
 
-// Starts an aggregated measurement campaign by running orfs_sensor with the given flags.
-func WithAggregated(amr types.AggregatedMeasurementRequest, flags ...CommandFlags) *sensorManager {
-	manager.Lock()
-	defer manager.Unlock()
-
-	manager.campaignId = amr.CampaignId
-	manager.begin = amr.Begin
-	manager.end = amr.End
+// Prepares an aggregated measurement campaign which runs orfs_sensor with the given flags.
+func WithAggregated(amr types.AggregatedMeasurementRequest, flags ...CommandFlags) *Campaign {
+	c := &Campaign{
+		Id:      amr.CampaignId,
+		Type:    "PSD",
+		Begin:   amr.Begin,
+		End:     amr.End,
+		FreqMin: amr.FreqMin,
+		FreqMax: amr.FreqMax,
+		FreqRes: amr.FreqRes,
+		TimeRes: amr.TimeRes,
+		Flags:   baseFlags,
+	}
 
 	if len(flags) > 0 {
-		manager.flags = flags[0]
+		c.Flags = flags[0]
 	}
 
 	monitorTime := amr.End.Unix() - amr.Begin.Unix()
-	manager.flags.MonitorTime = strconv.FormatInt(monitorTime, 10)
+	c.Flags.MonitorTime = strconv.FormatInt(monitorTime, 10)
 
 	// Set type-specific command parameters
-	manager.flags.MeasurementType = "PSD"
-	manager.flags.MinFreq = strconv.FormatInt(amr.FreqMin, 10)
-	manager.flags.MaxFreq = strconv.FormatInt(amr.FreqMax, 10)
-	manager.flags.MinTimeRes = strconv.FormatInt(amr.TimeRes, 10)
+	c.Flags.MeasurementType = c.Type
+	c.Flags.MinFreq = strconv.FormatInt(amr.FreqMin, 10)
+	c.Flags.MaxFreq = strconv.FormatInt(amr.FreqMax, 10)
+	c.Flags.MinTimeRes = strconv.FormatInt(amr.TimeRes, 10)
 
-	return manager
+	return c
 }
 
-// Starts a raw measurement campaign by running orfs_sensor with the given flags
-func WithRaw(rmr types.RawMeasurementRequest, flags ...CommandFlags) *sensorManager {
-	manager.Lock()
-	defer manager.Unlock()
-
-	manager.campaignId = rmr.CampaignId
-	manager.begin = rmr.Begin
-	manager.end = rmr.End
+// Prepares a raw measurement campaign which runs orfs_sensor with the given flags.
+func WithRaw(rmr types.RawMeasurementRequest, flags ...CommandFlags) *Campaign {
+	c := &Campaign{
+		Id:      rmr.CampaignId,
+		Type:    "IQ",
+		Begin:   rmr.Begin,
+		End:     rmr.End,
+		FreqMin: rmr.FreqCenter,
+		FreqMax: rmr.FreqCenter,
+		Flags:   baseFlags,
+	}
 
 	if len(flags) > 0 {
-		manager.flags = flags[0]
+		c.Flags = flags[0]
 	}
 
 	monitorTime := rmr.End.Unix() - rmr.Begin.Unix()
-	manager.flags.MonitorTime = strconv.FormatInt(monitorTime, 10)
+	c.Flags.MonitorTime = strconv.FormatInt(monitorTime, 10)
 
 	// Set type-specific command parameters
-	manager.flags.MeasurementType = "IQ"
-	manager.flags.MinFreq = fmt.Sprint(rmr.FreqCenter)
-	manager.flags.MaxFreq = fmt.Sprint(rmr.FreqCenter)
+	c.Flags.MeasurementType = c.Type
+	c.Flags.MinFreq = fmt.Sprint(rmr.FreqCenter)
+	c.Flags.MaxFreq = fmt.Sprint(rmr.FreqCenter)
 
-	return manager
+	return c
 }
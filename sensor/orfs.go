@@ -0,0 +1,26 @@
+package sensor
+
+import (
+	"io"
+)
+
+const orfsBackendName = "orfs"
+
+// Type orfsBackend runs campaigns with orfs_sensor (or a compatible program),
+// using the command line flags described by CommandFlags.
+type orfsBackend struct{}
+
+// orfsBackend implements Backend.
+var _ Backend = orfsBackend{}
+
+func (orfsBackend) Name() string {
+	return orfsBackendName
+}
+
+func (orfsBackend) CommandLine(c *Campaign) ([]string, error) {
+	return generateFlags(c.Flags), nil
+}
+
+func (orfsBackend) Start(c *Campaign, stdout io.Writer, stderr io.Writer) (Process, error) {
+	return startCommand(c.Id, generateFlags(c.Flags), stdout, stderr)
+}
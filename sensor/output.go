@@ -0,0 +1,205 @@
+package sensor
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Maximum length of a single line of output, longer lines are split.
+const maxLineLength = 64 * 1024
+
+// Type Line is a single line of output from the sensor process.
+type Line struct {
+	CampaignId string `json:"campaignId"`
+
+	// Either "stdout" or "stderr"
+	Stream string `json:"stream"`
+
+	Text string    `json:"text"`
+	Time time.Time `json:"time"`
+}
+
+// Type outputLog keeps the last lines of output of a campaign in a bounded ring
+// buffer and forwards them to a channel, dropping lines over a rate limit.
+type outputLog struct {
+	campaignId string
+
+	// Ring buffer of lines, next is the index of the oldest one when full
+	lines []Line
+	next  int
+	full  bool
+
+	// Token bucket used for rate limiting, in lines per second
+	rate    float64
+	tokens  float64
+	last    time.Time
+	dropped int
+
+	out chan<- Line
+
+	// Total bytes of output received
+	size int64
+
+	sync.Mutex
+}
+
+// Creates a new output log keeping at most size lines and forwarding at most
+// rate lines per second to out. A rate of 0 disables rate limiting.
+func newOutputLog(campaignId string, size int, rate float64, out chan<- Line) *outputLog {
+	if size < 1 {
+		size = 1
+	}
+
+	return &outputLog{
+		campaignId: campaignId,
+		lines:      make([]Line, size),
+		rate:       rate,
+		tokens:     rate,
+		last:       time.Now(),
+		out:        out,
+	}
+}
+
+// Stores a line in the ring buffer and forwards it if the rate limit allows.
+func (o *outputLog) add(stream string, text string) {
+	o.Lock()
+	defer o.Unlock()
+
+	line := Line{
+		CampaignId: o.campaignId,
+		Stream:     stream,
+		Text:       text,
+		Time:       time.Now(),
+	}
+
+	o.lines[o.next] = line
+	o.next = (o.next + 1) % len(o.lines)
+	if o.next == 0 {
+		o.full = true
+	}
+
+	if !o.allow(line.Time) {
+		o.dropped++
+		return
+	}
+
+	// Let subscribers know some lines are missing from the stream
+	if o.dropped > 0 {
+		o.forward(Line{
+			CampaignId: o.campaignId,
+			Stream:     stream,
+			Text:       fmt.Sprintf("[%d lines dropped]", o.dropped),
+			Time:       line.Time,
+		})
+		o.dropped = 0
+	}
+	o.forward(line)
+}
+
+// Refills the token bucket and takes a token, if available. Must be called with
+// the lock held.
+func (o *outputLog) allow(now time.Time) bool {
+	if o.rate <= 0 {
+		return true
+	}
+
+	o.tokens = math.Min(o.rate, o.tokens+now.Sub(o.last).Seconds()*o.rate)
+	o.last = now
+	if o.tokens < 1 {
+		return false
+	}
+
+	o.tokens--
+	return true
+}
+
+// Sends a line without blocking the process output: lines are dropped if
+// nobody is consuming them. Must be called with the lock held.
+func (o *outputLog) forward(line Line) {
+	if o.out == nil {
+		return
+	}
+
+	select {
+	case o.out <- line:
+	default:
+		o.dropped++
+	}
+}
+
+// Returns the buffered lines, oldest first.
+func (o *outputLog) Lines() []Line {
+	o.Lock()
+	defer o.Unlock()
+
+	if !o.full {
+		return append([]Line{}, o.lines[:o.next]...)
+	}
+	return append(append([]Line{}, o.lines[o.next:]...), o.lines[:o.next]...)
+}
+
+// Returns the total bytes of output received, including lines no longer buffered.
+func (o *outputLog) Size() int64 {
+	o.Lock()
+	defer o.Unlock()
+	return o.size
+}
+
+// Returns a writer which splits its input in lines and adds them to the log.
+func (o *outputLog) writer(stream string) *lineWriter {
+	return &lineWriter{
+		log:    o,
+		stream: stream,
+	}
+}
+
+// Type lineWriter splits whatever is written to it in lines and adds them to
+// an output log. Incomplete lines are kept until the next write or Flush.
+type lineWriter struct {
+	log    *outputLog
+	stream string
+	buf    []byte
+
+	sync.Mutex
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.log.Lock()
+	w.log.size += int64(len(p))
+	w.log.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log.add(w.stream, string(bytes.TrimSuffix(w.buf[:i], []byte{'\r'})))
+		w.buf = w.buf[i+1:]
+	}
+
+	// Avoid unbounded growth with processes which never write a newline
+	if len(w.buf) >= maxLineLength {
+		w.log.add(w.stream, string(w.buf))
+		w.buf = nil
+	}
+
+	return len(p), nil
+}
+
+// Adds the last incomplete line, if any, to the log.
+func (w *lineWriter) Flush() {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.buf) > 0 {
+		w.log.add(w.stream, string(w.buf))
+		w.buf = nil
+	}
+}
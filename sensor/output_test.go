@@ -0,0 +1,43 @@
+package sensor
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOutputLog(t *testing.T) {
+	t.Run("ring buffer", func(t *testing.T) {
+		o := newOutputLog("campaign", 3, 0, nil)
+		for i := 0; i < 5; i++ {
+			o.add("stdout", fmt.Sprint(i))
+		}
+
+		lines := o.Lines()
+		if len(lines) != 3 {
+			t.Fatalf("expected 3 lines, got %d", len(lines))
+		}
+		for i, l := range lines {
+			if l.Text != fmt.Sprint(i+2) {
+				t.Fatalf("expected line %d to be %d, got %s", i, i+2, l.Text)
+			}
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		out := make(chan Line, 100)
+		o := newOutputLog("campaign", 100, 5, out)
+		for i := 0; i < 20; i++ {
+			o.add("stderr", fmt.Sprint(i))
+		}
+
+		if len(out) != 5 {
+			t.Fatalf("expected 5 forwarded lines, got %d", len(out))
+		}
+		if len(o.Lines()) != 20 {
+			t.Fatalf("all lines must be buffered, got %d", len(o.Lines()))
+		}
+		if o.dropped != 15 {
+			t.Fatalf("expected 15 dropped lines, got %d", o.dropped)
+		}
+	})
+}
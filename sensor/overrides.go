@@ -0,0 +1,69 @@
+package sensor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/structs"
+)
+
+// Flags which can be overridden by measurement requests, by configuration name
+var allowedOverrides = map[string]bool{}
+
+// Type FlagOverrides maps flag names, as used in the configuration under
+// node.sensor (for example "gain" or "log2FFTsize"), to the values requested
+// for a single campaign.
+type FlagOverrides map[string]string
+
+// Sets the flags which can be overridden by measurement requests.
+func setAllowedOverrides(names []string) {
+	allowedOverrides = map[string]bool{}
+	for _, name := range names {
+		allowedOverrides[name] = true
+	}
+}
+
+// Returns the flags of the given struct field names, keyed by configuration name.
+func flagFields(flags *CommandFlags) map[string]*structs.Field {
+	ret := map[string]*structs.Field{}
+	for _, f := range structs.New(flags).Fields() {
+		if name := f.Tag("yaml"); name != "" && f.Tag("flag") != "" {
+			ret[name] = f
+		}
+	}
+	return ret
+}
+
+// Returns a copy of flags with the overrides applied. Unknown flags, flags which
+// are not allowed to be overridden and empty values are all reported in a
+// single error wrapping ErrInvalidCampaign.
+func (o FlagOverrides) apply(flags CommandFlags) (CommandFlags, error) {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := flagFields(&flags)
+	problems := []string{}
+	for _, name := range names {
+		value := strings.TrimSpace(o[name])
+		f, ok := fields[name]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("unknown flag %s", name))
+		case !allowedOverrides[name]:
+			problems = append(problems, fmt.Sprintf("flag %s cannot be overridden", name))
+		case value == "":
+			problems = append(problems, fmt.Sprintf("flag %s has no value", name))
+		default:
+			_ = f.Set(value)
+		}
+	}
+
+	if len(problems) > 0 {
+		return flags, fmt.Errorf("%w: %s", ErrInvalidCampaign, strings.Join(problems, ", "))
+	}
+	return flags, nil
+}
@@ -0,0 +1,101 @@
+package sensor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/providers/structs"
+)
+
+func TestFlagOverrides(t *testing.T) {
+	setAllowedOverrides([]string{"gain", "log2FFTsize"})
+	defer setAllowedOverrides(nil)
+
+	base := CommandFlags{
+		Command:  "orfs_sensor",
+		Gain:     "10",
+		DevIndex: "0",
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		flags, err := FlagOverrides{"gain": "30", "log2FFTsize": " 10 "}.apply(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if flags.Gain != "30" || flags.Log2FFTsize != "10" || flags.DevIndex != "0" {
+			t.Fatalf("unexpected flags: %+v", flags)
+		}
+		if base.Gain != "10" {
+			t.Fatal("base flags were modified")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := FlagOverrides{"devIndex": "1", "Command": "rm", "gain": ""}.apply(base)
+		if !errors.Is(err, ErrInvalidCampaign) {
+			t.Fatalf("expected ErrInvalidCampaign, got %v", err)
+		}
+		for _, problem := range []string{"unknown flag Command", "flag devIndex cannot be overridden", "flag gain has no value"} {
+			if !strings.Contains(err.Error(), problem) {
+				t.Fatalf("expected %q in %q", problem, err)
+			}
+		}
+	})
+}
+
+func TestWithProfile(t *testing.T) {
+	setAllowedOverrides([]string{"gain"})
+	profiles = map[string]FlagOverrides{
+		"ism-868": {"gain": "30", "samplingRate": "2400000"},
+	}
+	defer func() {
+		setAllowedOverrides(nil)
+		profiles = map[string]FlagOverrides{}
+	}()
+
+	flags, err := WithProfile("ism-868", FlagOverrides{"gain": "40"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags.Gain != "40" || flags.SampRate != "2400000" {
+		t.Fatalf("unexpected flags: %+v", flags)
+	}
+
+	_, err = WithProfile("lte-survey", nil)
+	if !errors.Is(err, ErrUnknownProfile) {
+		t.Fatalf("expected ErrUnknownProfile, got %v", err)
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	// Same shape as the default configuration, where no profiles are set
+	defaults := struct {
+		Node struct {
+			Profiles map[string]map[string]string `yaml:"profiles"`
+		} `yaml:"node"`
+	}{}
+	k := koanf.New(".")
+	err := k.Load(structs.Provider(defaults, "yaml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadProfiles(k)
+	if err != nil || len(loaded) != 0 {
+		t.Fatalf("expected no profiles, got %v, %v", loaded, err)
+	}
+
+	err = k.Load(confmap.Provider(map[string]interface{}{
+		"node.profiles": map[string]interface{}{"ism-868": map[string]interface{}{"gain": "30"}},
+	}, "."), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = loadProfiles(k)
+	if err != nil || loaded["ism-868"]["gain"] != "30" {
+		t.Fatalf("unexpected profiles: %v, %v", loaded, err)
+	}
+}
@@ -0,0 +1,289 @@
+package sensor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/knadh/koanf"
+)
+
+// Root of the unified (v2) cgroup hierarchy.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// Period used for CPU quotas, in microseconds.
+const cpuPeriod = 100000
+
+// I/O scheduling classes, as understood by ioprio_set(2).
+var ioClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// Characters not allowed in cgroup names.
+var cgroupUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// Type ProcessLimits describes the resource limits and isolation applied to the
+// sensor process, as found in the configuration under node.process.
+type ProcessLimits struct {
+	// CPU quota in cores (for example 1.5), 0 for no limit. Requires cgroup v2
+	CPU float64 `yaml:"cpu" json:"cpu,omitempty"`
+
+	// Memory limit in megabytes, 0 for no limit
+	Memory int64 `yaml:"memory" json:"memory,omitempty"`
+
+	// Scheduling priority (-20 to 19), 0 keeps the one of the node
+	Nice int `yaml:"nice" json:"nice,omitempty"`
+
+	// I/O scheduling class (realtime, best-effort or idle) and priority (0 to 7)
+	IOClass    string `yaml:"ioClass" json:"ioClass,omitempty"`
+	IOPriority int    `yaml:"ioPriority" json:"ioPriority,omitempty"`
+
+	// User and group (names or numeric IDs) to run the process as. The group
+	// defaults to the primary group of the user
+	User  string `yaml:"user" json:"user,omitempty"`
+	Group string `yaml:"group" json:"group,omitempty"`
+
+	// Working directory of the process
+	Dir string `yaml:"dir" json:"dir,omitempty"`
+
+	// Cgroup v2 directory under which a child cgroup is created for each campaign
+	Cgroup string `yaml:"cgroup" json:"cgroup,omitempty"`
+}
+
+// Type ProcessStatus reports the limits applied to the sensor process.
+type ProcessStatus struct {
+	Limits ProcessLimits `json:"limits"`
+
+	// Whether limits are enforced with cgroup v2 (true) or resource limits (false)
+	CgroupV2 bool `json:"cgroupV2"`
+}
+
+// Type processIsolation applies ProcessLimits to commands.
+type processIsolation struct {
+	limits ProcessLimits
+
+	credential *syscall.Credential
+	ioprio     int
+
+	// Parent cgroup, empty if cgroup v2 is not available
+	cgroup string
+}
+
+// Limits applied to every command started by the backends
+var isolation = &processIsolation{}
+
+// Loads the process limits from node.process and prepares the parent cgroup,
+// falling back to resource limits if cgroup v2 is not available.
+func newProcessIsolation(config *koanf.Koanf) (*processIsolation, error) {
+	pl := ProcessLimits{}
+	err := config.UnmarshalWithConf("node.process", &pl, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return nil, err
+	}
+
+	pi := &processIsolation{limits: pl}
+
+	if pl.Nice < -20 || pl.Nice > 19 {
+		return nil, fmt.Errorf("nice value %d is not between -20 and 19", pl.Nice)
+	}
+
+	if pl.IOClass != "" {
+		class, ok := ioClasses[pl.IOClass]
+		if !ok {
+			return nil, fmt.Errorf("unknown I/O scheduling class %s", pl.IOClass)
+		}
+		if pl.IOPriority < 0 || pl.IOPriority > 7 {
+			return nil, fmt.Errorf("I/O priority %d is not between 0 and 7", pl.IOPriority)
+		}
+		pi.ioprio = class<<13 | pl.IOPriority
+	}
+
+	if pl.User != "" || pl.Group != "" {
+		pi.credential, err = lookupCredential(pl.User, pl.Group)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if pl.Dir != "" {
+		info, err := os.Stat(pl.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", pl.Dir)
+		}
+	}
+
+	if pl.Cgroup != "" && (pl.CPU > 0 || pl.Memory > 0) {
+		err := prepareCgroup(pl.Cgroup)
+		if err != nil {
+			log.Warnf("%v: cgroup v2 is not available, falling back to resource limits", err)
+		} else {
+			pi.cgroup = pl.Cgroup
+		}
+	}
+	if pi.cgroup == "" && pl.CPU > 0 {
+		log.Warn("CPU quota requires cgroup v2 and will not be enforced")
+	}
+
+	return pi, nil
+}
+
+// Resolves user and group names (or IDs) to a credential.
+func lookupCredential(userName string, groupName string) (*syscall.Credential, error) {
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			u, err = user.LookupId(userName)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown user %s", err, userName)
+		}
+		uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+	}
+
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			g, err = user.LookupGroupId(groupName)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown group %s", err, groupName)
+		}
+		gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+		cred.Gid = uint32(gid)
+	}
+
+	// Drop the supplementary groups of the node
+	cred.Groups = []uint32{}
+	return cred, nil
+}
+
+// Creates the parent cgroup and enables the cpu and memory controllers for its
+// children.
+func prepareCgroup(path string) error {
+	_, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(filepath.Clean(path), cgroupRoot+"/") {
+		return fmt.Errorf("cgroup %s is not under %s", path, cgroupRoot)
+	}
+
+	err = os.MkdirAll(path, 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(path, "cgroup.subtree_control"), []byte("+cpu +memory"), 0o644)
+}
+
+// Returns the command running args (the first element is the executable) with
+// the limits applied. Unless no limits are configured, the node itself is run as
+// a launcher (see RunLauncher) which applies them and then executes the command,
+// so that they are in effect from its first instruction. Also returns the path
+// of the cgroup created for the command, if any, which must be removed with
+// release after it exits.
+func (pi *processIsolation) command(name string, args []string) (*exec.Cmd, string, error) {
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, "", err
+	}
+
+	spec := launchSpec{
+		Nice:       pi.limits.Nice,
+		IOPrio:     pi.ioprio,
+		Credential: pi.credential,
+		Dir:        pi.limits.Dir,
+	}
+
+	if pi.cgroup != "" {
+		spec.Cgroup = filepath.Join(pi.cgroup, cgroupUnsafe.ReplaceAllString(name, "_"))
+		err := pi.createCgroup(spec.Cgroup)
+		if err != nil {
+			log.Warnf("%v: could not create cgroup %s, falling back to resource limits", err, spec.Cgroup)
+			pi.release(spec.Cgroup)
+			spec.Cgroup = ""
+		}
+	}
+	if spec.Cgroup == "" && pi.limits.Memory > 0 {
+		spec.Memory = uint64(pi.limits.Memory) * 1024 * 1024
+	}
+
+	if spec == (launchSpec{}) {
+		cmd := exec.Command(path, args[1:]...)
+		cmd.Args[0] = args[0]
+		return cmd, "", nil
+	}
+
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		pi.release(spec.Cgroup)
+		return nil, "", err
+	}
+	cmd := &exec.Cmd{
+		Path: launcherPath,
+		Args: append([]string{launcherArg, string(encoded), path}, args...),
+	}
+	return cmd, spec.Cgroup, nil
+}
+
+// Creates a cgroup with the configured limits.
+func (pi *processIsolation) createCgroup(path string) error {
+	err := os.Mkdir(path, 0o755)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	if pi.limits.CPU > 0 {
+		quota := fmt.Sprintf("%d %d", int64(pi.limits.CPU*cpuPeriod), cpuPeriod)
+		err := os.WriteFile(filepath.Join(path, "cpu.max"), []byte(quota), 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	if pi.limits.Memory > 0 {
+		bytes := strconv.FormatInt(pi.limits.Memory*1024*1024, 10)
+		err := os.WriteFile(filepath.Join(path, "memory.max"), []byte(bytes), 0o644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes a cgroup created by command. Cgroups can only be removed once empty.
+func (pi *processIsolation) release(path string) {
+	if path == "" {
+		return
+	}
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("%v: could not remove cgroup %s", err, path)
+	}
+}
+
+// Returns the limits applied to the sensor process.
+func Isolation() ProcessStatus {
+	return ProcessStatus{
+		Limits:   isolation.limits,
+		CgroupV2: isolation.cgroup != "",
+	}
+}
@@ -0,0 +1,96 @@
+package sensor
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+)
+
+func TestMain(m *testing.M) {
+	// Commands with limits are started through the test binary
+	RunLauncher()
+	os.Exit(m.Run())
+}
+
+func newTestIsolation(t *testing.T, process map[string]interface{}) (*processIsolation, error) {
+	config := koanf.New(".")
+	err := config.Load(confmap.Provider(map[string]interface{}{"node.process": process}, "."), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newProcessIsolation(config)
+}
+
+func TestProcessIsolation(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		for _, process := range []map[string]interface{}{
+			{"nice": 20},
+			{"ioClass": "fast"},
+			{"ioClass": "idle", "ioPriority": 8},
+			{"dir": "/nonexistent"},
+		} {
+			if _, err := newTestIsolation(t, process); err == nil {
+				t.Fatalf("expected an error for %v", process)
+			}
+		}
+	})
+
+	t.Run("nice and working directory", func(t *testing.T) {
+		dir := t.TempDir()
+		pi, err := newTestIsolation(t, map[string]interface{}{
+			"nice":   5,
+			"dir":    dir,
+			"cgroup": "",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func(prev *processIsolation) { isolation = prev }(isolation)
+		isolation = pi
+
+		// The shell reports its own nice value (the 19th field of stat, after the
+		// command name in parentheses) as soon as it starts
+		out := &strings.Builder{}
+		proc, err := startCommand("test", []string{"sh", "-c", `pwd; cut -d " " -f 19 /proc/$$/stat`}, out, os.Stderr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := proc.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Fields(out.String())
+		if len(lines) != 2 || lines[0] != dir || lines[1] != "5" {
+			t.Fatalf("expected working directory %s and nice value 5, got %q", dir, out.String())
+		}
+	})
+}
+
+func TestLauncherMemoryLimit(t *testing.T) {
+	pi, err := newTestIsolation(t, map[string]interface{}{
+		"memory": 64,
+		"cgroup": "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(prev *processIsolation) { isolation = prev }(isolation)
+	isolation = pi
+
+	out := &strings.Builder{}
+	proc, err := startCommand("test", []string{"sh", "-c", `grep "Max address space" /proc/$$/limits`}, out, os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proc.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := strings.Fields(out.String())
+	if len(fields) < 5 || fields[3] != "67108864" {
+		t.Fatalf("expected an address space limit of 64 MB, got %q", out.String())
+	}
+}
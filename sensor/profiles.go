@@ -0,0 +1,86 @@
+package sensor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/knadh/koanf"
+)
+
+// Returned (wrapped) when a request refers to a profile which is not configured.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// Type Profile is a named set of command line flags, layered over the defaults
+// in node.sensor when a campaign refers to it.
+type Profile struct {
+	Name string `json:"name"`
+
+	// Flag values by configuration name (see node.sensor)
+	Flags FlagOverrides `json:"flags"`
+}
+
+// Profiles from the configuration, by name
+var profiles = map[string]FlagOverrides{}
+
+// Loads the profiles described in the configuration under node.profiles.
+// Profiles are trusted, so any flag can be set regardless of node.overrides.
+func loadProfiles(config *koanf.Koanf) (map[string]FlagOverrides, error) {
+	// Decoded as plain maps first, since the default is an untyped nil map
+	raw := map[string]map[string]string{}
+	err := config.UnmarshalWithConf("node.profiles", &raw, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]FlagOverrides, len(raw))
+	for name, flags := range raw {
+		ret[name] = flags
+	}
+
+	fields := flagFields(&CommandFlags{})
+	for name, flags := range ret {
+		for flag := range flags {
+			if _, ok := fields[flag]; !ok {
+				return nil, fmt.Errorf("profile %s sets unknown flag %s", name, flag)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// Returns all the configured profiles, sorted by name.
+func Profiles() []Profile {
+	ret := make([]Profile, 0, len(profiles))
+	for name, flags := range profiles {
+		ret = append(ret, Profile{
+			Name:  name,
+			Flags: flags,
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// Returns the default command line flags with the given profile (if not empty)
+// and overrides applied in this order, to be passed to WithAggregated or WithRaw.
+func WithProfile(profile string, overrides FlagOverrides) (CommandFlags, error) {
+	flags := baseFlags
+	if profile != "" {
+		p, ok := profiles[profile]
+		if !ok {
+			return flags, fmt.Errorf("%w %s", ErrUnknownProfile, profile)
+		}
+		for name, f := range flagFields(&flags) {
+			if value, ok := p[name]; ok {
+				_ = f.Set(value)
+			}
+		}
+	}
+
+	return overrides.apply(flags)
+}
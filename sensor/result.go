@@ -0,0 +1,107 @@
+package sensor
+
+import (
+	"time"
+)
+
+// Type EndReason describes why a sensor process ended.
+type EndReason string
+
+const (
+	// The process exited on its own, successfully or not
+	ReasonExited EndReason = "EXITED"
+
+	// The process was terminated at the end of the campaign
+	ReasonDeadline EndReason = "DEADLINE"
+
+	// The process was terminated because the campaign was cancelled
+	ReasonCancelled EndReason = "CANCELLED"
+
+	// The process made no progress and was killed by the watchdog
+	ReasonStalled EndReason = "STALLED"
+
+	// The process was terminated by a signal not sent by the node
+	ReasonCrashed EndReason = "CRASHED"
+)
+
+// Type RunResult describes how a sensor process ended and the resources it used.
+type RunResult struct {
+	CampaignId string    `json:"campaignId"`
+	Reason     EndReason `json:"reason"`
+
+	// Command line the process was run with. The collector address differs from
+	// the one reported when the campaign was accepted if the data was metered for
+	// the watchdog
+	Command []string `json:"command,omitempty"`
+
+	// Exit code of the process, -1 if it did not exit normally
+	ExitCode int `json:"exitCode"`
+
+	// Name of the signal which terminated the process, if any
+	Signal string `json:"signal,omitempty"`
+
+	// Whether the node had to kill the process, either because it did not stop
+	// in time after being terminated or because it stalled
+	Killed bool `json:"killed"`
+
+	Started time.Time `json:"started"`
+	Ended   time.Time `json:"ended"`
+
+	// Wall-clock time and CPU time spent in user and kernel mode, in seconds
+	WallTime   float64 `json:"wallTime"`
+	UserTime   float64 `json:"userTime"`
+	SystemTime float64 `json:"systemTime"`
+}
+
+// Type RunOutput is sent when a sensor process ends, along with its last lines
+// of output.
+type RunOutput struct {
+	Result RunResult
+	Output string
+}
+
+// Interface cpuTimer is implemented by processes which can report the CPU time
+// they used after exiting.
+type cpuTimer interface {
+	CPUTime() (user time.Duration, system time.Duration)
+}
+
+// Returns the CPU time used by an exited command, if known.
+func (p execProcess) CPUTime() (time.Duration, time.Duration) {
+	if p.ProcessState == nil {
+		return 0, 0
+	}
+	return p.ProcessState.UserTime(), p.ProcessState.SystemTime()
+}
+
+// Classifies the end of a process from the error returned by Process.Wait and
+// what the node did to stop it.
+func newRunResult(c *Campaign, proc Process, err error, started time.Time, cancelled bool, terminated bool, killed bool, stalled bool) RunResult {
+	res := RunResult{
+		CampaignId: c.Id,
+		Killed:     killed || stalled,
+		Started:    started,
+		Ended:      time.Now(),
+	}
+	res.WallTime = res.Ended.Sub(started).Seconds()
+	res.ExitCode, res.Signal = exitStatus(err)
+	if ct, ok := proc.(cpuTimer); ok {
+		user, system := ct.CPUTime()
+		res.UserTime, res.SystemTime = user.Seconds(), system.Seconds()
+	}
+
+	switch {
+	case stalled:
+		res.Reason = ReasonStalled
+	case cancelled:
+		res.Reason = ReasonCancelled
+	case terminated:
+		res.Reason = ReasonDeadline
+	case res.Signal != "":
+		res.Reason = ReasonCrashed
+	default:
+		res.Reason = ReasonExited
+	}
+
+	return res
+}
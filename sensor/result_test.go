@@ -0,0 +1,43 @@
+package sensor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		reason   EndReason
+		exitCode int
+		signal   string
+	}{
+		{"exited", "exit 3", ReasonExited, 3, ""},
+		{"crashed", "kill -9 $$", ReasonCrashed, -1, "killed"},
+		{"deadline", "exec sleep 10", ReasonDeadline, -1, "terminated"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend, err := newTemplateBackend("sh", []string{"-c", test.script})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := newTestManager()
+			m.backend = backend
+			m.err = make(chan error, 10)
+
+			now := time.Now()
+			m.run(&Campaign{Id: test.name, Begin: now, End: now.Add(500 * time.Millisecond)})
+
+			res := (<-m.output).Result
+			if res.Reason != test.reason || res.ExitCode != test.exitCode || res.Signal != test.signal {
+				t.Fatalf("unexpected result: %+v", res)
+			}
+			if res.Killed || res.WallTime <= 0 || m.last == nil {
+				t.Fatalf("unexpected result: %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package sensor
+
+import (
+	"strconv"
+	"time"
+)
+
+// Type RetryPolicy describes how campaigns which failed are retried, as found
+// in the configuration under node.retry.
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one. 1 disables retries
+	Attempts int `yaml:"attempts"`
+
+	// Seconds to wait before the first retry, doubled after each attempt
+	Backoff int64 `yaml:"backoff"`
+
+	// Upper limit for the time between attempts, in seconds
+	MaxBackoff int64 `yaml:"maxBackoff"`
+}
+
+// Type Attempt reports a failed attempt at running a campaign.
+type Attempt struct {
+	CampaignId string `json:"campaignId"`
+
+	// Number of the failed attempt, starting from 1
+	Attempt     int `json:"attempt"`
+	MaxAttempts int `json:"maxAttempts"`
+
+	// Why the attempt failed
+	Reason string `json:"reason"`
+
+	// Begin time of the next attempt, null if the campaign was given up
+	Next *time.Time `json:"next"`
+
+	Time time.Time `json:"time"`
+}
+
+// Returns the time to wait after the given (failed) attempt.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return time.Duration(backoff) * time.Second
+}
+
+// Queues a failed campaign again according to the retry policy, if there is
+// still time before its end. The attempt is reported on the retries channel
+// either way. Local campaigns are never retried nor reported.
+func (m *sensorManager) retry(c *Campaign, cause error) {
+	if c.local {
+		return
+	}
+
+	c.Attempt++
+	attempt := Attempt{
+		CampaignId:  c.Id,
+		Attempt:     c.Attempt,
+		MaxAttempts: m.policy.Attempts,
+		Reason:      cause.Error(),
+		Time:        time.Now(),
+	}
+
+	next := attempt.Time.Add(m.policy.delay(c.Attempt))
+	if c.Attempt < m.policy.Attempts && next.Before(c.End) {
+		c.Begin = next
+		// The process must not run past the end of the campaign
+		if c.Flags.MonitorTime != "" {
+			c.Flags.MonitorTime = strconv.FormatInt(c.End.Unix()-c.Begin.Unix(), 10)
+		}
+
+		err := m.schedule(c)
+		if err == nil {
+			log.Infof("campaign %s failed (attempt %d of %d), retrying at %s", c.Id, c.Attempt, m.policy.Attempts, next)
+			attempt.Next = &next
+		} else {
+			log.Warnf("%v: could not retry campaign %s", err, c.Id)
+		}
+	}
+	if attempt.Next == nil {
+		log.Warnf("giving up on campaign %s after %d attempts", c.Id, c.Attempt)
+	}
+
+	if m.retries != nil {
+		m.retries <- attempt
+	}
+}
+
+// Open channel where failed attempts at running campaigns are sent.
+func Retries() <-chan Attempt {
+	return retriesChan
+}
@@ -0,0 +1,70 @@
+package sensor
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// Type failingBackend never manages to start a process.
+type failingBackend struct {
+	starts chan string
+}
+
+func (failingBackend) Name() string {
+	return "failing"
+}
+
+func (failingBackend) CommandLine(*Campaign) ([]string, error) {
+	return nil, nil
+}
+
+func (b failingBackend) Start(c *Campaign, stdout io.Writer, stderr io.Writer) (Process, error) {
+	b.starts <- c.Id
+	return nil, errors.New("usb_claim_interface error -6")
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{Attempts: 5, Backoff: 5, MaxBackoff: 12}
+	for attempt, expected := range map[int]time.Duration{1: 5 * time.Second, 2: 10 * time.Second, 3: 12 * time.Second, 4: 12 * time.Second} {
+		if d := p.delay(attempt); d != expected {
+			t.Fatalf("expected delay %s after attempt %d, got %s", expected, attempt, d)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	backend := failingBackend{make(chan string, 10)}
+	m := newTestManager()
+	m.backend = backend
+	m.err = make(chan error, 10)
+	m.retries = make(chan Attempt, 10)
+	m.policy = RetryPolicy{Attempts: 3}
+	go m.scheduler()
+
+	now := time.Now()
+	err := m.schedule(&Campaign{Id: "retry", Begin: now, End: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		a := <-m.retries
+		if a.Attempt != i {
+			t.Fatalf("expected attempt %d, got %d", i, a.Attempt)
+		}
+		if (a.Next == nil) != (i == 3) {
+			t.Fatalf("attempt %d: unexpected next attempt %v", i, a.Next)
+		}
+	}
+	if len(backend.starts) != 3 {
+		t.Fatalf("expected 3 starts, got %d", len(backend.starts))
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	if m.status != Error || len(m.queue) != 0 {
+		t.Fatalf("expected a manager in error with an empty queue, got %s with %d campaigns", m.status, len(m.queue))
+	}
+}
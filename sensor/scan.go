@@ -0,0 +1,415 @@
+package sensor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/openrfsense/common/types"
+)
+
+const (
+	// Duration of a quick scan when not specified, in seconds
+	defaultScanDuration = 5
+
+	// Quick scans are meant to be short, longer measurements should be campaigns
+	maxScanDuration = 60
+
+	// Duration of a live measurement when not specified and its upper limit, in seconds
+	defaultLiveDuration = 60
+	maxLiveDuration     = 3600
+
+	// Extra time given to a scan to start and stop before giving up on it
+	scanGrace = 10 * time.Second
+
+	// Range of the reported PSD values in dBm, empty bins being at the bottom
+	minPowerDB = -200
+	maxPowerDB = 200
+)
+
+// Type ScanRequest describes a short PSD sweep run locally, for example to check
+// that the antenna and the SDR work.
+type ScanRequest struct {
+	// Frequency range and resolution in Hz
+	FreqMin int64 `json:"freqMin"`
+	FreqMax int64 `json:"freqMax"`
+	FreqRes int64 `json:"freqRes"`
+
+	// Duration in seconds, defaults to 5 for quick scans and 60 for live measurements
+	Duration int64 `json:"duration"`
+
+	// Name of a profile from node.profiles, optional
+	Profile string `json:"profile,omitempty"`
+}
+
+// Type Frame is a single PSD sweep over the requested frequency range, received
+// during a quick scan or a live measurement.
+type Frame struct {
+	Time    time.Time `json:"time"`
+	FreqMin int64     `json:"freqMin"`
+	FreqMax int64     `json:"freqMax"`
+
+	// PSD in dBm, one value per bin from FreqMin to FreqMax
+	Values []float64 `json:"values"`
+}
+
+// Type ScanResult is the spectrum measured by a quick scan.
+type ScanResult struct {
+	CampaignId string  `json:"campaignId"`
+	Device     string  `json:"device"`
+	Outcome    Outcome `json:"outcome"`
+
+	FreqMin int64 `json:"freqMin"`
+	FreqMax int64 `json:"freqMax"`
+
+	// Number of sweeps received and total bytes of data
+	Frames int   `json:"frames"`
+	Bytes  int64 `json:"bytes"`
+
+	// Average PSD over all sweeps in dBm, one value per bin from FreqMin to
+	// FreqMax. Empty if the data could not be decoded
+	Values []float64 `json:"values"`
+
+	// Output of the sensor process
+	Output []Line `json:"output"`
+}
+
+// Runs a short PSD sweep through the sensor managers. The data is captured
+// locally instead of being sent to the collector. Blocking.
+//
+// The data sent by orfs_sensor is decoded with the Avro schema it is given
+// (node.sensor.schemaFile), unless it is sent in a self-describing container.
+// Data in other formats is only counted (see segmentDecoder).
+func Scan(req ScanRequest) (*ScanResult, error) {
+	if req.Duration == 0 {
+		req.Duration = defaultScanDuration
+	}
+	return scan(context.Background(), req, maxScanDuration, nil)
+}
+
+// Runs a local PSD measurement like Scan, calling onFrame for every frame as
+// soon as it is received. The measurement is cancelled when ctx is done. Blocking.
+func Live(ctx context.Context, req ScanRequest, onFrame func(Frame)) (*ScanResult, error) {
+	if req.Duration == 0 {
+		req.Duration = defaultLiveDuration
+	}
+	return scan(ctx, req, maxLiveDuration, onFrame)
+}
+
+// Schedules a local measurement and waits for it to end (or for ctx to be
+// done). Blocking.
+func scan(ctx context.Context, req ScanRequest, maxDuration int64, onFrame func(Frame)) (*ScanResult, error) {
+	if req.Duration < 0 || req.Duration > maxDuration {
+		return nil, fmt.Errorf("%w: duration must be between 1 and %d seconds", ErrInvalidCampaign, maxDuration)
+	}
+
+	flags, err := WithProfile(req.Profile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	capture, err := newScanCapture(req, flags, onFrame)
+	if err != nil {
+		return nil, err
+	}
+	defer capture.close()
+
+	now := time.Now()
+	c := WithAggregated(types.AggregatedMeasurementRequest{
+		CampaignId: "scan-" + uuid.NewString(),
+		Begin:      now,
+		End:        now.Add(time.Duration(req.Duration) * time.Second),
+		FreqMin:    req.FreqMin,
+		FreqMax:    req.FreqMax,
+		FreqRes:    req.FreqRes,
+		TimeRes:    1,
+	}, flags)
+	c.Flags.SslCollector = capture.addr() + "#"
+	c.local = true
+	c.done = make(chan struct{})
+
+	err = Schedule(c)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("started quick scan %s", c.Id)
+
+	timeout := time.After(time.Until(c.End) + afterTermTimeout + scanGrace)
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		_ = Cancel(c.Id)
+		select {
+		case <-c.done:
+		case <-timeout:
+			return nil, fmt.Errorf("quick scan %s did not stop in time", c.Id)
+		}
+	case <-timeout:
+		_ = Cancel(c.Id)
+		return nil, fmt.Errorf("quick scan %s did not complete in time", c.Id)
+	}
+
+	res := &ScanResult{
+		CampaignId: c.Id,
+		Device:     c.Device,
+		FreqMin:    c.FreqMin,
+		FreqMax:    c.FreqMax,
+		Outcome:    c.outcome,
+		Output:     []Line{},
+	}
+	if lines, err := Log(c.Id); err == nil {
+		res.Output = lines
+	}
+	capture.close()
+	res.Frames, res.Bytes, res.Values = capture.result()
+
+	return res, nil
+}
+
+// Type scanCapture stands in for the collector during a quick scan, assembling
+// the segments it receives into sweeps over the requested frequency range and
+// averaging them.
+type scanCapture struct {
+	listener net.Listener
+	decoder  segmentDecoder
+	wg       sync.WaitGroup
+
+	// Frequency range of the sweeps in Hz, split in bins of equal width
+	freqMin float64
+	freqMax float64
+
+	frames int
+	bytes  int64
+
+	// Sweep being assembled: sum of the linear power and number of values of
+	// each bin, start of the last segment and time of the first one
+	sweep     []float64
+	hits      []int
+	lastStart float64
+	sweepTime time.Time
+
+	// Sum of the linear power of each bin over all sweeps
+	sum []float64
+
+	// Called for every sweep, if set
+	onFrame func(Frame)
+
+	sync.Mutex
+}
+
+// Starts listening on a random local port for the data of a scan over the given
+// frequency range and resolution, sent with the given flags.
+func newScanCapture(req ScanRequest, flags CommandFlags, onFrame func(Frame)) (*scanCapture, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	bins := psdBins(req.FreqMin, req.FreqMax, req.FreqRes)
+	sc := &scanCapture{
+		listener: l,
+		decoder: segmentDecoder{
+			schemaFile: flags.SchemaFile,
+			sampRate:   sampRate(flags),
+		},
+		freqMin: float64(req.FreqMin),
+		freqMax: float64(req.FreqMax),
+		sweep:   make([]float64, bins),
+		hits:    make([]int, bins),
+		sum:     make([]float64, bins),
+		onFrame: onFrame,
+	}
+	go sc.accept()
+	return sc, nil
+}
+
+// Returns the address the sensor should send data to.
+func (sc *scanCapture) addr() string {
+	return sc.listener.Addr().String()
+}
+
+// Stops accepting connections and waits for the open ones to be closed by the
+// sensor. Can be called multiple times.
+func (sc *scanCapture) close() {
+	_ = sc.listener.Close()
+	sc.wg.Wait()
+}
+
+// Accepts connections until the listener is closed. Blocking.
+func (sc *scanCapture) accept() {
+	for {
+		conn, err := sc.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error(err)
+			}
+			return
+		}
+
+		sc.wg.Add(1)
+		go func() {
+			defer sc.wg.Done()
+			defer conn.Close()
+			sc.receive(conn)
+		}()
+	}
+}
+
+// Decodes segments until the sensor closes the connection. Data which cannot
+// be decoded is only counted. Blocking.
+func (sc *scanCapture) receive(r io.Reader) {
+	counted := &countingReader{r: r, count: func(n int) {
+		sc.Lock()
+		sc.bytes += int64(n)
+		sc.Unlock()
+	}}
+	br := bufio.NewReaderSize(counted, 64*1024)
+
+	err := sc.decoder.decode(br, sc.add)
+	if err != nil {
+		log.Warnf("%v: could not decode scan data", err)
+		_, _ = io.Copy(io.Discard, br)
+	}
+}
+
+// Adds a segment to the sweep being assembled. The sweep is complete when the
+// segment reaches the end of the frequency range, or when the next one starts
+// over from a lower frequency.
+func (sc *scanCapture) add(seg segment) {
+	sc.Lock()
+	var frames []Frame
+	if sc.sweepTime.IsZero() {
+		sc.sweepTime = seg.time
+	} else if seg.freqMin <= sc.lastStart {
+		frames = append(frames, sc.flush()...)
+		sc.sweepTime = seg.time
+	}
+	sc.lastStart = seg.freqMin
+
+	bins := len(sc.sweep)
+	binWidth := (sc.freqMax - sc.freqMin) / float64(bins)
+	segWidth := (seg.freqMax - seg.freqMin) / float64(len(seg.power))
+	for i, p := range seg.power {
+		if math.IsNaN(p) || math.IsInf(p, 0) || p < 0 {
+			continue
+		}
+		freq := seg.freqMin + (float64(i)+0.5)*segWidth
+		k := int(math.Floor((freq - sc.freqMin) / binWidth))
+		if k < 0 || k >= bins || binWidth <= 0 {
+			continue
+		}
+		sc.sweep[k] += p
+		sc.hits[k]++
+	}
+
+	if seg.freqMax >= sc.freqMax {
+		frames = append(frames, sc.flush()...)
+	}
+	sc.Unlock()
+
+	if sc.onFrame != nil {
+		for _, f := range frames {
+			sc.onFrame(f)
+		}
+	}
+}
+
+// Adds the sweep being assembled to the sums and resets it. Bins without values
+// take the one of the nearest bin with values. Returns the sweep as a frame, if
+// any values were received. Must be called with the lock held.
+func (sc *scanCapture) flush() []Frame {
+	filled := []int{}
+	for k, n := range sc.hits {
+		if n > 0 {
+			filled = append(filled, k)
+		}
+	}
+	if len(filled) == 0 {
+		sc.sweepTime = time.Time{}
+		return nil
+	}
+
+	// Bins are filled from the sweep before it is reset, since gaps can be
+	// followed by bins with values
+	values := make([]float64, len(sc.sweep))
+	next := 0
+	for k := range values {
+		for next < len(filled)-1 && filled[next] < k {
+			next++
+		}
+		nearest := filled[next]
+		if next > 0 && k-filled[next-1] < nearest-k {
+			nearest = filled[next-1]
+		}
+
+		power := sc.sweep[nearest] / float64(sc.hits[nearest])
+		sc.sum[k] += power
+		values[k] = toDB(power)
+	}
+	for k := range sc.sweep {
+		sc.sweep[k] = 0
+		sc.hits[k] = 0
+	}
+	sc.frames++
+
+	frame := Frame{
+		Time:    sc.sweepTime,
+		FreqMin: int64(sc.freqMin),
+		FreqMax: int64(sc.freqMax),
+		Values:  values,
+	}
+	sc.sweepTime = time.Time{}
+	return []Frame{frame}
+}
+
+// Returns the number of sweeps, total bytes and the average PSD in dBm. A sweep
+// still being assembled is completed first.
+func (sc *scanCapture) result() (int, int64, []float64) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	sc.flush()
+	if sc.frames == 0 {
+		return 0, sc.bytes, []float64{}
+	}
+
+	values := make([]float64, 0, len(sc.sum))
+	for _, s := range sc.sum {
+		values = append(values, toDB(s/float64(sc.frames)))
+	}
+	return sc.frames, sc.bytes, values
+}
+
+// Converts a linear power to dB, clamped to [minPowerDB, maxPowerDB] so that
+// the values can always be encoded as JSON.
+func toDB(power float64) float64 {
+	db := 10 * math.Log10(power)
+	switch {
+	case math.IsNaN(db) || db < minPowerDB:
+		return minPowerDB
+	case db > maxPowerDB:
+		return maxPowerDB
+	}
+	return db
+}
+
+// Type countingReader reports the number of bytes read through it.
+type countingReader struct {
+	r     io.Reader
+	count func(n int)
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 {
+		cr.count(n)
+	}
+	return n, err
+}
@@ -0,0 +1,157 @@
+package sensor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Type replayBackend starts processes which send recorded data to the collector
+// and exit.
+type replayBackend struct {
+	data []byte
+}
+
+func (replayBackend) Name() string {
+	return "replay"
+}
+
+func (replayBackend) CommandLine(*Campaign) ([]string, error) {
+	return nil, nil
+}
+
+func (rb replayBackend) Start(c *Campaign, stdout io.Writer, stderr io.Writer) (Process, error) {
+	conn, err := net.Dial("tcp", strings.TrimSuffix(c.Flags.SslCollector, "#"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &replayProcess{done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		defer conn.Close()
+		_, p.err = conn.Write(rb.data)
+	}()
+	return p, nil
+}
+
+type replayProcess struct {
+	done chan struct{}
+	err  error
+}
+
+func (p *replayProcess) Terminate() error { return nil }
+
+func (p *replayProcess) Kill() error { return nil }
+
+func (p *replayProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+func TestScan(t *testing.T) {
+	m := newTestManager()
+	m.name = "sim"
+	m.backend = simulatedBackend{SimulatedConfig{
+		NoiseFloor: -100,
+		Tones:      []SimulatedTone{{Frequency: 100050000, Power: -40}},
+	}}
+	go m.scheduler()
+
+	devices = []*sensorManager{m}
+	defer func() { devices = nil }()
+
+	res, err := Scan(ScanRequest{
+		FreqMin:  99000000,
+		FreqMax:  101000000,
+		FreqRes:  100000,
+		Duration: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Outcome != OutcomeDone || res.Frames < 1 || len(res.Values) != 20 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	peak := 0
+	for i, v := range res.Values {
+		if v > res.Values[peak] {
+			peak = i
+		}
+	}
+	if peak != 10 {
+		t.Fatalf("expected the tone in bin 10, got %d", peak)
+	}
+
+	if m.has(res.CampaignId) {
+		t.Fatal("scan is still scheduled")
+	}
+
+	// Quick scans are local to the node
+	for _, r := range History() {
+		if r.Id == res.CampaignId {
+			t.Fatal("scan was added to the history")
+		}
+	}
+	select {
+	case out := <-m.output:
+		t.Fatalf("scan output was reported: %+v", out)
+	default:
+	}
+}
+
+func TestLive(t *testing.T) {
+	codec := testCodec(t)
+	data := []byte{}
+	for _, s := range testSamples() {
+		var err error
+		data, err = codec.BinaryFromNative(data, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := newTestManager()
+	m.name = "orfs"
+	m.backend = replayBackend{data}
+	go m.scheduler()
+
+	devices = []*sensorManager{m}
+	defer func() { devices = nil }()
+	baseFlags.SchemaFile = testSchemaFile
+	defer func() { baseFlags.SchemaFile = "" }()
+
+	// The finer resolution leaves bins without values, which are filled
+	for freqRes, bins := range map[int64]int{250000: 16, 25000: 160} {
+		frames := []Frame{}
+		res, err := Live(context.Background(), ScanRequest{
+			FreqMin:  100000000,
+			FreqMax:  104000000,
+			FreqRes:  freqRes,
+			Duration: 2,
+		}, func(f Frame) {
+			frames = append(frames, f)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Outcome != OutcomeDone || res.Frames != 2 || len(frames) != 2 {
+			t.Fatalf("unexpected result with %d frames: %+v", len(frames), res)
+		}
+		for _, f := range frames {
+			if f.FreqMin != 100000000 || f.FreqMax != 104000000 || len(f.Values) != bins {
+				t.Fatalf("frames must cover the whole range: %+v", f)
+			}
+			// Frames are sent to the live clients as JSON
+			_, err := json.Marshal(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package sensor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/openrfsense/node/system"
+)
+
+// Returned when trying to cancel a campaign which is neither running nor scheduled.
+var ErrUnknownCampaign = errors.New("unknown campaign")
+
+// Returned (wrapped) when trying to schedule a campaign which is already scheduled.
+var ErrAlreadyScheduled = errors.New("already scheduled")
+
+// Queues a campaign to be started at its begin time. Campaigns which are invalid,
+// have already ended or overlap with a running or queued campaign are refused.
+func (m *sensorManager) schedule(c *Campaign) error {
+	err := m.limits.validate(c)
+	if err != nil {
+		return err
+	}
+
+	if !c.End.After(time.Now()) {
+		return fmt.Errorf("campaign %s has already ended", c.Id)
+	}
+
+	m.Lock()
+	other := m.current
+	if other == nil || !other.overlaps(c) {
+		other = nil
+		for _, q := range m.queue {
+			if q.overlaps(c) {
+				other = q
+				break
+			}
+		}
+	}
+	if other != nil {
+		m.Unlock()
+		if other.Id == c.Id {
+			return fmt.Errorf("%w: campaign %s is already scheduled", ErrAlreadyScheduled, c.Id)
+		}
+		return fmt.Errorf("campaign %s overlaps with campaign %s (%s - %s)", c.Id, other.Id, other.Begin, other.End)
+	}
+
+	c.Device = m.name
+	if m.index != "" {
+		c.Flags.DevIndex = m.index
+	}
+	// Set here so that CommandLine reports the flags the campaign will run with
+	c.Flags.CampaignId = c.Id
+	c.Flags.SensorId = system.ID()
+
+	m.queue = append(m.queue, c)
+	sort.SliceStable(m.queue, func(i, j int) bool {
+		return m.queue[i].Begin.Before(m.queue[j].Begin)
+	})
+	from := m.status
+	// Retries clear the error of the failed attempt
+	if m.status == Free || (m.status == Error && c.Attempt > 0) {
+		m.status = Scheduled
+	}
+	m.save()
+	m.emit(EventAccepted, c, from, "")
+	m.Unlock()
+
+	log.Debugf("scheduled campaign %s at %s on device %s", c.Id, c.Begin, m.name)
+	m.wakeUp()
+	return nil
+}
+
+// Removes a campaign which has not been started yet from the queue.
+func (m *sensorManager) unschedule(id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for i, c := range m.queue {
+		if c.Id == id {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			c.outcome = OutcomeCancelled
+			c.finish()
+			m.save()
+			from := m.status
+			m.settle()
+			m.emit(EventCancelled, c, from, "")
+			m.wakeUp()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w %s", ErrUnknownCampaign, id)
+}
+
+// Writes the queue to disk, if a queue file is configured. Must be called with
+// the lock held.
+func (m *sensorManager) save() {
+	if m.queuePath == "" {
+		return
+	}
+
+	queue := make([]*Campaign, 0, len(m.queue))
+	for _, c := range m.queue {
+		if !c.local {
+			queue = append(queue, c)
+		}
+	}
+
+	data, err := json.Marshal(queue)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	// Write to a temporary file first so the queue is never left half-written
+	tmp := m.queuePath + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err == nil {
+		err = os.Rename(tmp, m.queuePath)
+	}
+	if err != nil {
+		log.Errorf("%v: could not save campaign queue", err)
+	}
+}
+
+// Loads the queue saved by a previous run of the node, skipping campaigns which
+// have already ended.
+func (m *sensorManager) load(path string) error {
+	m.queuePath = path
+	if path == "" {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	saved := []*Campaign{}
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return fmt.Errorf("%w: could not parse campaign queue %s", err, path)
+	}
+
+	for _, c := range saved {
+		err := m.schedule(c)
+		if err != nil {
+			log.Warnf("%v, dropping it from the queue", err)
+		}
+	}
+
+	m.Lock()
+	m.save()
+	m.Unlock()
+
+	return nil
+}
+
+// Returns true if the campaign with the given ID is running or scheduled.
+func (m *sensorManager) has(id string) bool {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.current != nil && m.current.Id == id {
+		return true
+	}
+	for _, c := range m.queue {
+		if c.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Signals the scheduler loop that the queue has changed.
+func (m *sensorManager) wakeUp() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Resets the idle status according to the queue: the manager is either free
+// or waiting for the next campaign. Errors are kept until a retry is scheduled
+// or the next campaign starts. Must be called with the lock held.
+func (m *sensorManager) settle() {
+	if m.status != Free && m.status != Scheduled {
+		return
+	}
+
+	if len(m.queue) > 0 {
+		m.status = Scheduled
+	} else {
+		m.status = Free
+	}
+}
+
+// Waits for the first queued campaign's begin time and runs it. Campaigns are
+// run one at a time, in order. Blocking.
+func (m *sensorManager) scheduler() {
+	for {
+		m.RLock()
+		var next *Campaign
+		if len(m.queue) > 0 {
+			next = m.queue[0]
+		}
+		m.RUnlock()
+
+		if next == nil {
+			<-m.wake
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(next.Begin))
+		select {
+		case <-m.wake:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		m.Lock()
+		// The queue might have changed in the meantime
+		if len(m.queue) == 0 || m.queue[0] != next {
+			m.Unlock()
+			continue
+		}
+		m.queue = m.queue[1:]
+		m.save()
+		m.Unlock()
+
+		if !next.End.After(time.Now()) {
+			log.Warnf("campaign %s ended before it could be started, skipping", next.Id)
+			next.outcome = OutcomeFailed
+			next.finish()
+			m.Lock()
+			from := m.status
+			m.settle()
+			m.emit(EventFailed, next, from, "ended before it could be started")
+			m.Unlock()
+			continue
+		}
+
+		m.run(next)
+	}
+}
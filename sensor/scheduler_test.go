@@ -0,0 +1,110 @@
+package sensor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestManager() *sensorManager {
+	return &sensorManager{
+		status: Free,
+		wake:   make(chan struct{}, 1),
+		output: make(chan RunOutput, 1),
+		err:    make(chan error, 1),
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	m := newTestManager()
+	now := time.Now()
+
+	t.Run("ordered by begin time", func(t *testing.T) {
+		_ = m.schedule(&Campaign{Id: "b", Begin: now.Add(2 * time.Hour), End: now.Add(3 * time.Hour)})
+		_ = m.schedule(&Campaign{Id: "a", Begin: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+
+		if m.status != Scheduled {
+			t.Fatalf("expected status %s, got %s", Scheduled, m.status)
+		}
+		if m.queue[0].Id != "a" || m.queue[1].Id != "b" {
+			t.Fatalf("queue is not ordered: %s, %s", m.queue[0].Id, m.queue[1].Id)
+		}
+		if m.queue[0].Flags.CampaignId != "a" || m.queue[0].Flags.SensorId == "" {
+			t.Fatalf("scheduled campaigns must carry their IDs in the flags: %+v", m.queue[0].Flags)
+		}
+	})
+
+	t.Run("ended campaign", func(t *testing.T) {
+		err := m.schedule(&Campaign{Id: "c", Begin: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)})
+		if err == nil {
+			t.Fatal("campaigns which already ended must be refused")
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		if err := m.unschedule("a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cancel("a"); !errors.Is(err, ErrUnknownCampaign) {
+			t.Fatalf("cancelling an unknown campaign must fail with ErrUnknownCampaign, got %v", err)
+		}
+		if err := m.unschedule("b"); err != nil {
+			t.Fatal(err)
+		}
+		if m.status != Free {
+			t.Fatalf("expected status %s, got %s", Free, m.status)
+		}
+	})
+}
+
+func TestScheduleOverlap(t *testing.T) {
+	m := newTestManager()
+	now := time.Now()
+
+	err := m.schedule(&Campaign{Id: "a", Begin: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("overlapping window", func(t *testing.T) {
+		err := m.schedule(&Campaign{Id: "b", Begin: now.Add(90 * time.Minute), End: now.Add(3 * time.Hour)})
+		if err == nil {
+			t.Fatal("overlapping campaigns must be refused")
+		}
+	})
+
+	t.Run("duplicate ID", func(t *testing.T) {
+		err := m.schedule(&Campaign{Id: "a", Begin: now.Add(5 * time.Hour), End: now.Add(6 * time.Hour)})
+		if err == nil {
+			t.Fatal("campaigns with the same ID must be refused")
+		}
+	})
+
+	t.Run("adjacent window", func(t *testing.T) {
+		err := m.schedule(&Campaign{Id: "c", Begin: now.Add(2 * time.Hour), End: now.Add(3 * time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestQueuePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	now := time.Now()
+
+	m := newTestManager()
+	if err := m.load(path); err != nil {
+		t.Fatal(err)
+	}
+	_ = m.schedule(&Campaign{Id: "a", Begin: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	_ = m.schedule(&Campaign{Id: "b", Begin: now.Add(2 * time.Hour), End: now.Add(3 * time.Hour)})
+
+	restored := newTestManager()
+	if err := restored.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.queue) != 2 || restored.queue[0].Id != "a" || restored.queue[1].Id != "b" {
+		t.Fatalf("queue was not restored correctly: %v", restored.queue)
+	}
+}
@@ -0,0 +1,279 @@
+package sensor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf"
+)
+
+const simulatedBackendName = "simulated"
+
+const (
+	// Number of PSD bins used when the campaign has no frequency resolution
+	simDefaultBins = 256
+
+	// Upper limit for PSD bins in a single frame
+	simMaxBins = 4096
+
+	// Number of IQ samples in a single frame
+	simIQSamples = 1024
+
+	// Sampling rate used for IQ frames when not set in the flags
+	simDefaultSampRate = 2400000
+)
+
+// Type SimulatedTone is a synthetic signal added on top of the noise floor.
+type SimulatedTone struct {
+	// Center frequency in Hz
+	Frequency float64 `yaml:"frequency"`
+
+	// Peak power in dBm
+	Power float64 `yaml:"power"`
+
+	// Bandwidth in Hz, defaults to the frequency resolution of the campaign
+	Width float64 `yaml:"width"`
+}
+
+// Type SimulatedConfig configures the synthetic data produced by the simulated backend.
+type SimulatedConfig struct {
+	// Noise floor in dBm
+	NoiseFloor float64 `yaml:"noiseFloor"`
+
+	// Standard deviation of the noise in dB
+	NoiseDeviation float64 `yaml:"noiseDeviation"`
+
+	Tones []SimulatedTone `yaml:"tones"`
+}
+
+// Type simFrame is a single measurement sent by the simulated backend to the
+// collector, encoded as a line of JSON.
+type simFrame struct {
+	SensorId   string    `json:"sensorId"`
+	CampaignId string    `json:"campaignId"`
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	FreqMin    int64     `json:"freqMin"`
+	FreqMax    int64     `json:"freqMax"`
+
+	// Sampling rate in Hz (IQ only)
+	SampRate float64 `json:"sampRate,omitempty"`
+
+	// PSD values in dBm for each bin, or interleaved I and Q samples
+	Values []float64 `json:"values"`
+}
+
+// Type simulatedBackend produces synthetic PSD and IQ data without any SDR
+// hardware, so the campaign pipeline can be tested anywhere.
+type simulatedBackend struct {
+	config SimulatedConfig
+}
+
+// simulatedBackend implements Backend.
+var _ Backend = simulatedBackend{}
+
+// Loads the simulated backend configuration from node.backend.simulated.
+func newSimulatedBackend(config *koanf.Koanf) (simulatedBackend, error) {
+	sc := SimulatedConfig{
+		NoiseFloor:     -100,
+		NoiseDeviation: 1,
+	}
+	err := config.UnmarshalWithConf("node.backend.simulated", &sc, koanf.UnmarshalConf{Tag: "yaml"})
+	if err != nil {
+		return simulatedBackend{}, err
+	}
+
+	return simulatedBackend{sc}, nil
+}
+
+func (simulatedBackend) Name() string {
+	return simulatedBackendName
+}
+
+func (simulatedBackend) CommandLine(*Campaign) ([]string, error) {
+	return nil, nil
+}
+
+func (sb simulatedBackend) Start(c *Campaign, stdout io.Writer, stderr io.Writer) (Process, error) {
+	addr := strings.TrimSuffix(c.Flags.SslCollector, "#")
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &simProcess{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(p.done)
+		defer conn.Close()
+		p.err = sb.simulate(ctx, c, conn, stdout)
+		if p.err != nil {
+			fmt.Fprintln(stderr, p.err)
+		}
+	}()
+
+	return p, nil
+}
+
+// Sends a frame at the end of every time resolution interval until the
+// monitoring time has passed or the context is cancelled. Blocking.
+func (sb simulatedBackend) simulate(ctx context.Context, c *Campaign, w io.Writer, stdout io.Writer) error {
+	monitorTime, err := strconv.ParseInt(c.Flags.MonitorTime, 10, 64)
+	if err != nil || monitorTime <= 0 {
+		monitorTime = c.End.Unix() - c.Begin.Unix()
+	}
+	interval, err := strconv.ParseInt(c.Flags.MinTimeRes, 10, 64)
+	if err != nil || interval <= 0 || c.Type != "PSD" {
+		interval = 1
+	}
+
+	end := time.Now().Add(time.Duration(monitorTime) * time.Second)
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	enc := json.NewEncoder(w)
+	for frames := 1; ; frames++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		frame := simFrame{
+			SensorId:   c.Flags.SensorId,
+			CampaignId: c.Id,
+			Type:       c.Type,
+			Time:       time.Now(),
+			FreqMin:    c.FreqMin,
+			FreqMax:    c.FreqMax,
+		}
+		if c.Type == "IQ" {
+			frame.SampRate = sampRate(c.Flags)
+			frame.Values = sb.iq(rng, float64(c.FreqMin), frame.SampRate)
+		} else {
+			frame.Values = sb.psd(rng, c)
+		}
+
+		err := enc.Encode(frame)
+		if err != nil {
+			return fmt.Errorf("%w: could not send frame to the collector", err)
+		}
+		fmt.Fprintf(stdout, "sent %s frame %d (%d values)\n", c.Type, frames, len(frame.Values))
+
+		if !time.Now().Before(end) {
+			return nil
+		}
+	}
+}
+
+// Generates PSD values in dBm for the campaign frequency range.
+func (sb simulatedBackend) psd(rng *rand.Rand, c *Campaign) []float64 {
+	bins := psdBins(c.FreqMin, c.FreqMax, c.FreqRes)
+	binWidth := float64(c.FreqMax-c.FreqMin) / float64(bins)
+
+	values := make([]float64, bins)
+	for i := range values {
+		freq := float64(c.FreqMin) + (float64(i)+0.5)*binWidth
+		noise := sb.config.NoiseFloor + rng.NormFloat64()*sb.config.NoiseDeviation
+		power := math.Pow(10, noise/10)
+
+		for _, tone := range sb.config.Tones {
+			width := tone.Width
+			if width <= 0 {
+				width = math.Max(binWidth, 1)
+			}
+			offset := (freq - tone.Frequency) / width
+			power += math.Pow(10, tone.Power/10) * math.Exp(-0.5*offset*offset)
+		}
+
+		values[i] = 10 * math.Log10(power)
+	}
+
+	return values
+}
+
+// Generates interleaved IQ samples around the given center frequency. Only
+// tones within the sampled bandwidth are visible.
+func (sb simulatedBackend) iq(rng *rand.Rand, center float64, sampRate float64) []float64 {
+	noiseAmplitude := math.Pow(10, sb.config.NoiseFloor/20) / math.Sqrt2
+	phase := rng.Float64() * 2 * math.Pi
+
+	values := make([]float64, 0, 2*simIQSamples)
+	for k := 0; k < simIQSamples; k++ {
+		sample := complex(rng.NormFloat64()*noiseAmplitude, rng.NormFloat64()*noiseAmplitude)
+		for _, tone := range sb.config.Tones {
+			offset := tone.Frequency - center
+			if math.Abs(offset) > sampRate/2 {
+				continue
+			}
+			amplitude := math.Pow(10, tone.Power/20)
+			angle := 2*math.Pi*offset*float64(k)/sampRate + phase
+			sample += complex(amplitude, 0) * cmplx.Exp(complex(0, angle))
+		}
+		values = append(values, real(sample), imag(sample))
+	}
+
+	return values
+}
+
+// Returns the number of PSD bins for a frequency range and resolution, which is
+// also used to average the spectrum of quick scans.
+func psdBins(freqMin int64, freqMax int64, freqRes int64) int {
+	bins := simDefaultBins
+	span := float64(freqMax - freqMin)
+	if freqRes > 0 && span > 0 {
+		bins = int(math.Min(span/float64(freqRes), simMaxBins))
+	}
+	if bins < 1 {
+		bins = 1
+	}
+	return bins
+}
+
+// Returns the sampling rate set in the flags or a sensible default.
+func sampRate(flags CommandFlags) float64 {
+	rate, err := strconv.ParseFloat(flags.SampRate, 64)
+	if err != nil || rate <= 0 {
+		return simDefaultSampRate
+	}
+	return rate
+}
+
+// Type simProcess implements Process for the simulated backend.
+type simProcess struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// simProcess implements Process.
+var _ Process = &simProcess{}
+
+func (p *simProcess) Terminate() error {
+	p.cancel()
+	return nil
+}
+
+func (p *simProcess) Kill() error {
+	p.cancel()
+	return nil
+}
+
+func (p *simProcess) Wait() error {
+	<-p.done
+	return p.err
+}
@@ -0,0 +1,75 @@
+package sensor
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSimulatedBackend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sb := simulatedBackend{SimulatedConfig{
+		NoiseFloor: -100,
+		Tones: []SimulatedTone{
+			{Frequency: 170000000, Power: -40},
+		},
+	}}
+
+	now := time.Now()
+	c := &Campaign{
+		Id:      "campaign",
+		Type:    "PSD",
+		Begin:   now,
+		End:     now.Add(time.Minute),
+		FreqMin: 160000000,
+		FreqMax: 180000000,
+		FreqRes: 100000,
+		Flags: CommandFlags{
+			SslCollector: listener.Addr().String() + "#",
+			MonitorTime:  "1",
+			MinTimeRes:   "1",
+		},
+	}
+
+	proc, err := sb.Start(c, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	frame := simFrame{}
+	err = json.NewDecoder(bufio.NewReader(conn)).Decode(&frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := proc.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frame.Values) != 200 {
+		t.Fatalf("expected 200 bins, got %d", len(frame.Values))
+	}
+
+	// The tone is at the start of the second half of the range
+	peak := frame.Values[100]
+	if peak < -45 || peak > -35 {
+		t.Fatalf("expected a peak around -40dBm, got %f", peak)
+	}
+	if frame.Values[0] > -90 {
+		t.Fatalf("expected the noise floor around -100dBm, got %f", frame.Values[0])
+	}
+}
@@ -0,0 +1,92 @@
+package sensor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+const templateBackendName = "template"
+
+// Type templateBackend runs campaigns with an arbitrary command (rtl_power,
+// hackrf_sweep, soapy_power, etc.), whose arguments are generated from
+// text/template strings. Templates are executed on a templateData.
+type templateBackend struct {
+	command string
+	args    []*template.Template
+}
+
+// Type templateData is passed to argument templates. All the campaign fields
+// are available, for example {{.FreqMin}} or {{.Flags.Gain}}.
+type templateData struct {
+	*Campaign
+
+	// Campaign duration in seconds
+	Duration int64
+}
+
+// templateBackend implements Backend.
+var _ Backend = &templateBackend{}
+
+// Parses the argument templates for the given command.
+func newTemplateBackend(command string, args []string) (*templateBackend, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("template backend requires a command")
+	}
+
+	tb := &templateBackend{
+		command: command,
+		args:    make([]*template.Template, 0, len(args)),
+	}
+	for i, arg := range args {
+		t, err := template.New(fmt.Sprint(i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid template for argument %d", err, i)
+		}
+		tb.args = append(tb.args, t)
+	}
+
+	return tb, nil
+}
+
+func (*templateBackend) Name() string {
+	return templateBackendName
+}
+
+// Executes the argument templates for the given campaign. Arguments which end
+// up empty are skipped.
+func (tb *templateBackend) generateArgs(c *Campaign) ([]string, error) {
+	data := templateData{
+		Campaign: c,
+		Duration: c.End.Unix() - c.Begin.Unix(),
+	}
+
+	ret := []string{tb.command}
+	for i, t := range tb.args {
+		var buf bytes.Buffer
+		err := t.Execute(&buf, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not generate argument %d", err, i)
+		}
+		if buf.Len() > 0 {
+			ret = append(ret, buf.String())
+		}
+	}
+
+	return ret, nil
+}
+
+func (tb *templateBackend) CommandLine(c *Campaign) ([]string, error) {
+	return tb.generateArgs(c)
+}
+
+func (tb *templateBackend) Start(c *Campaign, stdout io.Writer, stderr io.Writer) (Process, error) {
+	args, err := tb.generateArgs(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return startCommand(c.Id, args, stdout, stderr)
+}
@@ -0,0 +1,63 @@
+package sensor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateBackend(t *testing.T) {
+	begin := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+	c := &Campaign{
+		Id:      "campaign",
+		Begin:   begin,
+		End:     begin.Add(10 * time.Minute),
+		FreqMin: 160000000,
+		FreqMax: 180000000,
+		FreqRes: 10000,
+		TimeRes: 5,
+		Flags:   CommandFlags{Gain: "20"},
+	}
+
+	t.Run("rtl_power", func(t *testing.T) {
+		tb, err := newTemplateBackend("rtl_power", []string{
+			"-f", "{{.FreqMin}}:{{.FreqMax}}:{{.FreqRes}}",
+			"-i", "{{.TimeRes}}",
+			"-e", "{{.Duration}}s",
+			"{{if .Flags.Gain}}-g{{end}}", "{{.Flags.Gain}}",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		args, err := tb.generateArgs(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := strings.Join(args, " ")
+		expected := "rtl_power -f 160000000:180000000:10000 -i 5 -e 600s -g 20"
+		if result != expected {
+			t.Fatalf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		tb, err := newTemplateBackend("hackrf_sweep", []string{"{{.Unknown}}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tb.generateArgs(c)
+		if err == nil {
+			t.Fatal("unknown fields must make argument generation fail")
+		}
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		_, err := newTemplateBackend(" ", nil)
+		if err == nil {
+			t.Fatal("the command must not be empty")
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package sensor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned (wrapped) when a campaign cannot be run with the current hardware
+// or makes no sense at all.
+var ErrInvalidCampaign = errors.New("invalid campaign")
+
+// Type Limits describes what the sensing hardware can do. Zero values mean
+// there is no limit.
+type Limits struct {
+	// Lowest tunable frequency in Hz
+	MinFreq int64 `yaml:"minFreq" json:"minFreq"`
+
+	// Highest tunable frequency in Hz
+	MaxFreq int64 `yaml:"maxFreq" json:"maxFreq"`
+
+	// Maximum sampling rate in samples per second
+	MaxSampRate int64 `yaml:"maxSampRate" json:"maxSampRate"`
+
+	// Maximum campaign duration in seconds
+	MaxDuration int64 `yaml:"maxDuration" json:"maxDuration"`
+}
+
+// Checks the campaign for consistency and against the hardware limits. All
+// problems are reported in a single error wrapping ErrInvalidCampaign.
+func (l Limits) validate(c *Campaign) error {
+	problems := []string{}
+
+	if strings.TrimSpace(c.Id) == "" {
+		problems = append(problems, "campaign ID is empty")
+	}
+	if !c.Begin.Before(c.End) {
+		problems = append(problems, fmt.Sprintf("begin (%s) must be before end (%s)", c.Begin, c.End))
+	}
+	if c.FreqMin < 0 {
+		problems = append(problems, fmt.Sprintf("minimum frequency (%d Hz) must be positive", c.FreqMin))
+	}
+	if c.FreqMin > c.FreqMax {
+		problems = append(problems, fmt.Sprintf("minimum frequency (%d Hz) must not be higher than maximum frequency (%d Hz)", c.FreqMin, c.FreqMax))
+	}
+	if c.FreqRes < 0 || c.TimeRes < 0 {
+		problems = append(problems, "frequency and time resolutions must be positive")
+	}
+
+	if l.MinFreq > 0 && c.FreqMin < l.MinFreq {
+		problems = append(problems, fmt.Sprintf("frequency %d Hz is below the device minimum (%d Hz)", c.FreqMin, l.MinFreq))
+	}
+	if l.MaxFreq > 0 && c.FreqMax > l.MaxFreq {
+		problems = append(problems, fmt.Sprintf("frequency %d Hz is above the device maximum (%d Hz)", c.FreqMax, l.MaxFreq))
+	}
+	if l.MaxDuration > 0 && c.End.Sub(c.Begin) > time.Duration(l.MaxDuration)*time.Second {
+		problems = append(problems, fmt.Sprintf("duration %s is longer than the maximum (%s)", c.End.Sub(c.Begin), time.Duration(l.MaxDuration)*time.Second))
+	}
+	if rate, err := strconv.ParseFloat(c.Flags.SampRate, 64); err == nil && l.MaxSampRate > 0 && rate > float64(l.MaxSampRate) {
+		problems = append(problems, fmt.Sprintf("sampling rate %s is above the device maximum (%d)", c.Flags.SampRate, l.MaxSampRate))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w %s: %s", ErrInvalidCampaign, c.Id, strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package sensor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	limits := Limits{
+		MinFreq:     24000000,
+		MaxFreq:     1766000000,
+		MaxSampRate: 3200000,
+		MaxDuration: 3600,
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		campaign Campaign
+		valid    bool
+	}{
+		{
+			name:     "valid campaign",
+			campaign: Campaign{Id: "a", Begin: now, End: now.Add(time.Minute), FreqMin: 160000000, FreqMax: 180000000},
+			valid:    true,
+		},
+		{
+			name:     "end before begin",
+			campaign: Campaign{Id: "a", Begin: now, End: now.Add(-time.Minute), FreqMin: 160000000, FreqMax: 180000000},
+		},
+		{
+			name:     "freqMin > freqMax",
+			campaign: Campaign{Id: "a", Begin: now, End: now.Add(time.Minute), FreqMin: 180000000, FreqMax: 160000000},
+		},
+		{
+			name:     "frequency above hardware range",
+			campaign: Campaign{Id: "a", Begin: now, End: now.Add(time.Minute), FreqMin: 160000000, FreqMax: 2400000000},
+		},
+		{
+			name:     "frequency below hardware range",
+			campaign: Campaign{Id: "a", Begin: now, End: now.Add(time.Minute), FreqMin: 1000000, FreqMax: 160000000},
+		},
+		{
+			name:     "too long",
+			campaign: Campaign{Id: "a", Begin: now, End: now.Add(2 * time.Hour), FreqMin: 160000000, FreqMax: 180000000},
+		},
+		{
+			name: "sampling rate too high",
+			campaign: Campaign{
+				Id: "a", Begin: now, End: now.Add(time.Minute), FreqMin: 160000000, FreqMax: 160000000,
+				Flags: CommandFlags{SampRate: "10000000"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := limits.validate(&test.campaign)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidCampaign) {
+				t.Fatalf("expected ErrInvalidCampaign, got %v", err)
+			}
+		})
+	}
+}
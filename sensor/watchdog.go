@@ -0,0 +1,202 @@
+package sensor
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Shortest time between two checks of the watchdog.
+const minWatchdogCheck = time.Second
+
+// Minimum number of time resolution intervals the watchdog waits for, since
+// processes may be silent while averaging over one.
+const watchdogResolutions = 3
+
+// Type Stall reports a campaign whose process was killed by the watchdog
+// because it stopped making progress.
+type Stall struct {
+	CampaignId string `json:"campaignId"`
+	Device     string `json:"device"`
+
+	// Seconds since the last progress was made
+	Idle float64 `json:"idle"`
+
+	// Bytes written by the process on stdout and stderr, and sent to the collector
+	OutputSize int64 `json:"outputSize"`
+	SentBytes  int64 `json:"sentBytes"`
+
+	Time time.Time `json:"time"`
+}
+
+// Type meter is a TCP relay between the sensor process and the collector,
+// counting the bytes sent by the process.
+type meter struct {
+	listener net.Listener
+	target   string
+	bytes    int64
+	wg       sync.WaitGroup
+}
+
+// Starts a meter on a random local port, forwarding to target.
+func newMeter(target string) (*meter, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	mt := &meter{
+		listener: l,
+		target:   target,
+	}
+	go mt.accept()
+	return mt, nil
+}
+
+// Returns the address the sensor should send data to.
+func (mt *meter) addr() string {
+	return mt.listener.Addr().String()
+}
+
+// Returns the number of bytes sent to the collector so far.
+func (mt *meter) sent() int64 {
+	return atomic.LoadInt64(&mt.bytes)
+}
+
+// Stops accepting connections and waits for the open ones to be closed.
+func (mt *meter) close() {
+	_ = mt.listener.Close()
+	mt.wg.Wait()
+}
+
+// Relays connections until the listener is closed. Blocking.
+func (mt *meter) accept() {
+	for {
+		in, err := mt.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error(err)
+			}
+			return
+		}
+
+		mt.wg.Add(1)
+		go func() {
+			defer mt.wg.Done()
+			mt.relay(in)
+		}()
+	}
+}
+
+// Forwards data between the process and the collector until either side closes
+// the connection. Blocking.
+func (mt *meter) relay(in net.Conn) {
+	defer in.Close()
+
+	out, err := net.DialTimeout("tcp", mt.target, 10*time.Second)
+	if err != nil {
+		log.Warnf("%v: could not connect to the collector", err)
+		return
+	}
+	defer out.Close()
+
+	go func() {
+		_, _ = io.Copy(in, out)
+		_ = in.Close()
+	}()
+	_, _ = io.Copy(&countingWriter{out, &mt.bytes}, in)
+}
+
+// Type countingWriter adds the number of bytes written to a counter.
+type countingWriter struct {
+	io.Writer
+	count *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(w.count, int64(n))
+	return n, err
+}
+
+// Returns the watchdog interval for a campaign, which is at least a few of its
+// time resolution intervals.
+func (m *sensorManager) watchdogWindow(c *Campaign) time.Duration {
+	res, err := strconv.ParseInt(c.Flags.MinTimeRes, 10, 64)
+	if err != nil || res <= 0 {
+		res = c.TimeRes
+	}
+
+	window := m.watchdog
+	if min := time.Duration(res*watchdogResolutions) * time.Second; window < min {
+		window = min
+	}
+	return window
+}
+
+// Kills the process when neither its output nor the data sent to the collector
+// (if metered) grow for the watchdog interval (see watchdogWindow). Returns when
+// done is closed. Returns true if the process was killed. Blocking.
+func (m *sensorManager) watch(c *Campaign, proc Process, tail *outputLog, mt *meter, done <-chan struct{}) bool {
+	window := m.watchdogWindow(c)
+	check := window / 4
+	if check < minWatchdogCheck {
+		check = minWatchdogCheck
+	}
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+
+	progress := func() int64 {
+		p := tail.Size()
+		if mt != nil {
+			p += mt.sent()
+		}
+		return p
+	}
+
+	last, lastTime := progress(), time.Now()
+	for {
+		select {
+		case <-done:
+			return false
+		case now := <-ticker.C:
+			if p := progress(); p != last {
+				last, lastTime = p, now
+				continue
+			}
+			if now.Sub(lastTime) < window {
+				continue
+			}
+
+			stall := Stall{
+				CampaignId: c.Id,
+				Device:     m.name,
+				Idle:       now.Sub(lastTime).Seconds(),
+				OutputSize: tail.Size(),
+				Time:       now,
+			}
+			if mt != nil {
+				stall.SentBytes = mt.sent()
+			}
+			log.Warnf("campaign %s made no progress for %.0f seconds, killing the process", c.Id, stall.Idle)
+
+			err := proc.Kill()
+			if err != nil {
+				log.Errorf("%v: could not kill stalled process", err)
+			}
+			if m.stalled != nil && !c.local {
+				m.stalled <- stall
+			}
+			return true
+		}
+	}
+}
+
+// Open channel where campaigns killed by the watchdog are sent.
+func Stalls() <-chan Stall {
+	return stalledChan
+}
@@ -0,0 +1,152 @@
+package sensor
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Type hangingBackend starts processes which never do anything until killed.
+type hangingBackend struct{}
+
+func (hangingBackend) Name() string {
+	return "hanging"
+}
+
+func (hangingBackend) CommandLine(*Campaign) ([]string, error) {
+	return nil, nil
+}
+
+func (hangingBackend) Start(c *Campaign, stdout io.Writer, stderr io.Writer) (Process, error) {
+	return &hangingProcess{make(chan struct{})}, nil
+}
+
+type hangingProcess struct {
+	killed chan struct{}
+}
+
+func (p *hangingProcess) Terminate() error { return nil }
+
+func (p *hangingProcess) Kill() error {
+	close(p.killed)
+	return nil
+}
+
+func (p *hangingProcess) Wait() error {
+	<-p.killed
+	return errors.New("signal: killed")
+}
+
+func TestWatchdog(t *testing.T) {
+	m := newTestManager()
+	m.backend = hangingBackend{}
+	m.err = make(chan error, 10)
+	m.stalled = make(chan Stall, 1)
+	m.watchdog = time.Second
+
+	now := time.Now()
+	c := &Campaign{Id: "hung", Begin: now, End: now.Add(time.Hour)}
+	m.run(c)
+
+	select {
+	case stall := <-m.stalled:
+		if stall.CampaignId != "hung" || stall.Idle < 1 {
+			t.Fatalf("unexpected stall: %+v", stall)
+		}
+	default:
+		t.Fatal("no stall was reported")
+	}
+
+	var runErr *RunError
+	if err := <-m.err; !errors.As(err, &runErr) || runErr.Code != CodeStalled {
+		t.Fatalf("expected a %s error, got %v", CodeStalled, err)
+	}
+}
+
+func TestWatchdogWindow(t *testing.T) {
+	m := newTestManager()
+	m.watchdog = time.Minute
+
+	for _, tc := range []struct {
+		campaign Campaign
+		window   time.Duration
+	}{
+		{Campaign{}, time.Minute},
+		{Campaign{TimeRes: 10}, time.Minute},
+		{Campaign{TimeRes: 60}, 3 * time.Minute},
+		{Campaign{TimeRes: 1, Flags: CommandFlags{MinTimeRes: "120"}}, 6 * time.Minute},
+	} {
+		if w := m.watchdogWindow(&tc.campaign); w != tc.window {
+			t.Fatalf("expected a window of %s for %+v, got %s", tc.window, tc.campaign, w)
+		}
+	}
+}
+
+func TestMeter(t *testing.T) {
+	collector, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Close()
+	received := make(chan []byte)
+	go func() {
+		conn, err := collector.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	mt, err := newMeter(collector.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", mt.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("measurement"))
+	_ = conn.Close()
+
+	if data := <-received; string(data) != "measurement" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+	mt.close()
+	if mt.sent() != int64(len("measurement")) {
+		t.Fatalf("expected %d bytes, got %d", len("measurement"), mt.sent())
+	}
+}
+
+func TestMeteredCommand(t *testing.T) {
+	collector, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer collector.Close()
+
+	m := newTestManager()
+	m.watchdog = time.Minute
+	m.backend, err = newTemplateBackend("sh", []string{"-c", "exit 0", "sh", "{{.Flags.SslCollector}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	c := &Campaign{Id: "metered", Begin: now, End: now.Add(time.Hour)}
+	c.Flags.SslCollector = collector.Addr().String() + "#"
+	accepted, err := m.backend.CommandLine(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.run(c)
+
+	// The process is run with the relay as collector, which the result reports
+	command := (<-m.output).Result.Command
+	if len(command) != len(accepted) || command[len(command)-1] == accepted[len(accepted)-1] || !strings.HasSuffix(command[len(command)-1], "#") {
+		t.Fatalf("expected the collector %s to be replaced by the relay, got %q", c.Flags.SslCollector, command)
+	}
+}
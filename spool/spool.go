@@ -0,0 +1,703 @@
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knadh/koanf"
+
+	"github.com/openrfsense/common/logging"
+)
+
+const (
+	// Segments are closed and made available for forwarding after this many
+	// bytes or this much time, whichever comes first
+	segmentSize    = 1024 * 1024
+	segmentTimeout = time.Second
+
+	// Bounds for the exponential backoff used when the collector is unreachable
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+
+	dialTimeout = 10 * time.Second
+)
+
+// File name extensions used in the spool directory: data is written to .tmp
+// files, which become .seg when complete. A .eos file marks the end of an
+// incoming connection.
+const (
+	extTemp    = ".tmp"
+	extSegment = ".seg"
+	extEnd     = ".eos"
+)
+
+// Type Spool is a TCP proxy which stores everything it receives on disk and
+// forwards it to the collector, retrying until the collector is reachable.
+// Every incoming connection is forwarded on its own outgoing connection, in order.
+// The byte stream of a connection is never altered: if the collector connection
+// fails, the incoming connection is sent again from its start on a new one, and
+// data is only dropped by whole incoming connections.
+type Spool struct {
+	dir     string
+	maxSize int64
+	target  string
+
+	listener net.Listener
+
+	// Incoming connection counter, used to name segments
+	conns uint64
+
+	// Used to notify the forwarder of new segments
+	notify chan struct{}
+
+	// Forwarding progress of the oldest incoming connection
+	fwd progress
+
+	// Incoming connections dropped while still receiving, their data is discarded
+	dropped map[uint64]bool
+
+	stats Stats
+
+	sync.Mutex
+}
+
+// Type progress tracks how much of an incoming connection was written to the
+// current collector connection.
+type progress struct {
+	conn uint64
+
+	// Next segment to send
+	part uint64
+
+	// Bytes written to the collector connection
+	bytes int64
+
+	// Whether segments already sent were deleted to make room, in which case the
+	// connection cannot be sent again from its start
+	trimmed bool
+}
+
+// Type Stats reports the status of the spool.
+type Stats struct {
+	// Bytes currently waiting on disk
+	Pending int64 `json:"pending"`
+
+	// Bytes sent to the collector
+	Forwarded int64 `json:"forwarded"`
+
+	// Bytes dropped because the spool was full
+	Dropped int64 `json:"dropped"`
+
+	// Whether the collector is currently reachable
+	Connected bool `json:"connected"`
+}
+
+var spool *Spool
+
+var log = logging.New().
+	WithPrefix("spool").
+	WithLevel(logging.DebugLevel).
+	WithFlags(logging.FlagsDevelopment)
+
+// Starts the spool singleton as described in the configuration under node.spool,
+// forwarding data to collector.host:collector.port.
+func Start(config *koanf.Koanf) error {
+	var err error
+	spool, err = New(
+		fmt.Sprintf("127.0.0.1:%d", config.MustInt("node.spool.port")),
+		fmt.Sprintf("%s:%d", config.String("collector.host"), config.MustInt("collector.port")),
+		config.String("node.spool.dir"),
+		int64(config.Int("node.spool.size"))*1024*1024,
+	)
+	return err
+}
+
+// Stops accepting data. Data already on disk is forwarded on the next start.
+func Stop() {
+	if spool != nil {
+		spool.Close()
+	}
+}
+
+// Returns the spool statistics, or nil if the spool is not running.
+func GetStats() *Stats {
+	if spool == nil {
+		return nil
+	}
+	s := spool.Stats()
+	return &s
+}
+
+// Creates a spool listening on addr and forwarding to target, storing at most
+// maxSize bytes in dir. Data left over from previous runs is forwarded too.
+func New(addr string, target string, dir string, maxSize int64) (*Spool, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		dir:     dir,
+		maxSize: maxSize,
+		target:  target,
+		notify:  make(chan struct{}, 1),
+		dropped: map[uint64]bool{},
+	}
+
+	err = s.recover()
+	if err != nil {
+		return nil, err
+	}
+
+	s.listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("spooling %s to %s", s.listener.Addr(), target)
+
+	go s.accept()
+	go s.forward()
+	s.wakeUp()
+
+	return s, nil
+}
+
+// Returns the local address the spool is listening on.
+func (s *Spool) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Stops accepting connections.
+func (s *Spool) Close() {
+	_ = s.listener.Close()
+}
+
+// Returns a copy of the current statistics.
+func (s *Spool) Stats() Stats {
+	s.Lock()
+	defer s.Unlock()
+	return s.stats
+}
+
+// Prepares data left over by a previous run for forwarding: incomplete segments
+// are closed and all incoming connections are marked as ended.
+func (s *Spool) recover() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		conn, _, ok := parseName(name)
+		if !ok {
+			continue
+		}
+		if conn >= s.conns {
+			s.conns = conn + 1
+		}
+
+		if filepath.Ext(name) == extTemp {
+			path := filepath.Join(s.dir, name)
+			err := os.Rename(path, strings.TrimSuffix(path, extTemp)+extSegment)
+			if err != nil {
+				return err
+			}
+		}
+		if filepath.Ext(name) != extEnd {
+			err := touch(filepath.Join(s.dir, fmt.Sprintf("%016d%s", conn, extEnd)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	s.stats.Pending = s.size()
+	return nil
+}
+
+// Accepts incoming connections until the listener is closed. Blocking.
+func (s *Spool) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		s.Lock()
+		id := s.conns
+		s.conns++
+		s.Unlock()
+
+		go s.receive(id, conn)
+	}
+}
+
+// Writes everything received on conn to segments on disk. Blocking.
+func (s *Spool) receive(id uint64, conn net.Conn) {
+	defer conn.Close()
+	log.Debugf("receiving connection %d from %s", id, conn.RemoteAddr())
+
+	buf := make([]byte, 32*1024)
+	var (
+		part    uint64
+		file    *os.File
+		written int
+		opened  time.Time
+	)
+
+	// Segments of dropped connections are deleted instead of being completed
+	closeSegment := func() {
+		if file == nil {
+			return
+		}
+		_ = file.Close()
+		path := file.Name()
+		s.Lock()
+		var err error
+		if s.dropped[id] {
+			err = os.Remove(path)
+		} else {
+			err = os.Rename(path, strings.TrimSuffix(path, extTemp)+extSegment)
+		}
+		s.Unlock()
+		if err != nil {
+			log.Error(err)
+		}
+		file = nil
+		part++
+		s.enforceLimit()
+		s.wakeUp()
+	}
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(segmentTimeout))
+		n, err := conn.Read(buf)
+
+		if n > 0 && s.isDropped(id) {
+			// Read until the end anyway, so the sender does not block
+			closeSegment()
+			s.Lock()
+			s.stats.Dropped += int64(n)
+			s.Unlock()
+			n = 0
+		}
+		if n > 0 {
+			if file == nil {
+				var cerr error
+				file, cerr = os.Create(filepath.Join(s.dir, fmt.Sprintf("%016d-%08d%s", id, part, extTemp)))
+				if cerr != nil {
+					log.Errorf("%v: dropping connection %d", cerr, id)
+					break
+				}
+				written = 0
+				opened = time.Now()
+			}
+
+			_, werr := file.Write(buf[:n])
+			if werr != nil {
+				log.Errorf("%v: dropping connection %d", werr, id)
+				break
+			}
+			written += n
+			s.Lock()
+			s.stats.Pending += int64(n)
+			s.Unlock()
+		}
+
+		timeout := false
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			timeout = true
+		} else if err != nil {
+			if err != io.EOF {
+				log.Error(err)
+			}
+			break
+		}
+
+		if file != nil && (written >= segmentSize || (timeout && time.Since(opened) >= segmentTimeout)) {
+			closeSegment()
+		}
+	}
+
+	closeSegment()
+
+	s.Lock()
+	defer s.Unlock()
+	if s.dropped[id] {
+		delete(s.dropped, id)
+		return
+	}
+	err := touch(filepath.Join(s.dir, fmt.Sprintf("%016d%s", id, extEnd)))
+	if err != nil {
+		log.Error(err)
+	}
+	s.wakeUp()
+}
+
+// Returns true if the incoming connection was dropped to make room.
+func (s *Spool) isDropped(id uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.dropped[id]
+}
+
+// Makes the spool fit in its maximum size: segments already sent on the current
+// collector connection are deleted first, then whole incoming connections are
+// dropped, oldest first. Single segments are never dropped, since that would
+// leave a hole in the stream.
+func (s *Spool) enforceLimit() {
+	if s.maxSize <= 0 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	size := s.size()
+	if size > s.maxSize && s.fwd.part > 0 {
+		for _, name := range s.segments(s.fwd.conn) {
+			if _, part, _ := parseName(name); part >= s.fwd.part {
+				break
+			}
+			if removed := removeFile(filepath.Join(s.dir, name)); removed >= 0 {
+				size -= removed
+				s.fwd.trimmed = true
+			}
+		}
+	}
+
+	for _, conn := range s.connections() {
+		if size <= s.maxSize {
+			break
+		}
+		dropped := s.drop(conn)
+		log.Warnf("spool is full, dropped connection %d (%d bytes)", conn, dropped)
+		size -= dropped
+	}
+	s.stats.Pending = size
+}
+
+// Deletes all the data of an incoming connection. If it is still receiving, the
+// rest of its data is discarded. Returns the number of bytes dropped. Must be
+// called with the lock held.
+func (s *Spool) drop(conn uint64) int64 {
+	var dropped int64
+	for _, name := range s.segments(conn) {
+		if removed := removeFile(filepath.Join(s.dir, name)); removed >= 0 {
+			dropped += removed
+		}
+	}
+
+	// Incomplete segments are deleted by the receiver
+	end := filepath.Join(s.dir, fmt.Sprintf("%016d%s", conn, extEnd))
+	if removeFile(end) < 0 {
+		s.dropped[conn] = true
+	}
+	for _, name := range s.list(extTemp) {
+		if c, _, _ := parseName(name); c == conn {
+			if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+				dropped += info.Size()
+			}
+		}
+	}
+
+	s.stats.Dropped += dropped
+	return dropped
+}
+
+// Sends segments to the target, one incoming connection at a time. Blocking.
+func (s *Spool) forward() {
+	backoff := minBackoff
+	var out net.Conn
+
+	disconnect := func() {
+		if out != nil {
+			_ = out.Close()
+			out = nil
+		}
+	}
+
+	for {
+		next, end, changed := s.next()
+		if changed {
+			// The previous incoming connection was dropped
+			disconnect()
+		}
+		if next == "" && end == "" {
+			<-s.notify
+			continue
+		}
+
+		// The incoming connection ended and all of its data was sent
+		if next == "" {
+			s.finish(end)
+			disconnect()
+			continue
+		}
+
+		if out == nil {
+			var err error
+			out, err = net.DialTimeout("tcp", s.target, dialTimeout)
+			if err != nil {
+				s.setConnected(false)
+				log.Warnf("%v: collector unreachable, retrying in %s", err, backoff)
+				time.Sleep(backoff)
+				backoff *= 2
+				if backoff > maxBackoff {
+					backoff = maxBackoff
+				}
+				continue
+			}
+			s.setConnected(true)
+			backoff = minBackoff
+
+			// A new collector connection must receive the incoming connection
+			// from its start
+			if !s.rewind() {
+				disconnect()
+				continue
+			}
+			if _, part, _ := parseName(next); part != 0 {
+				continue
+			}
+		}
+
+		n, err := s.send(out, next)
+		if err != nil {
+			log.Warnf("%v: could not forward segment %s", err, next)
+			s.setConnected(false)
+			disconnect()
+			continue
+		}
+		s.advance(next, n)
+	}
+}
+
+// Returns the next segment to send from the oldest incoming connection, or its
+// end marker if the connection ended and was fully forwarded. Also returns true
+// if the oldest connection changed without its end being reached.
+func (s *Spool) next() (string, string, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	conns := s.connections()
+	ends := s.list(extEnd)
+	for _, name := range ends {
+		if conn, _, _ := parseName(name); len(conns) == 0 || conn < conns[0] {
+			conns = append([]uint64{conn}, conns...)
+		}
+	}
+	if len(conns) == 0 {
+		return "", "", false
+	}
+
+	oldest := conns[0]
+	changed := false
+	if oldest != s.fwd.conn {
+		changed = s.fwd.part > 0
+		s.fwd = progress{conn: oldest}
+	}
+
+	for _, name := range s.segments(oldest) {
+		if _, part, _ := parseName(name); part >= s.fwd.part {
+			return name, "", changed
+		}
+	}
+
+	// End markers are only written after the last segment is complete
+	for _, name := range ends {
+		if conn, _, _ := parseName(name); conn == oldest {
+			return "", name, changed
+		}
+	}
+
+	// The connection is still receiving data
+	return "", "", changed
+}
+
+// Prepares the incoming connection being forwarded to be sent from its start on a
+// new collector connection. If it cannot, because part of it was deleted to make
+// room, the connection is dropped and false is returned.
+func (s *Spool) rewind() bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.fwd.part == 0 {
+		return true
+	}
+	if s.fwd.trimmed {
+		dropped := s.drop(s.fwd.conn)
+		log.Warnf("connection %d was interrupted and cannot be sent again, dropped %d bytes", s.fwd.conn, dropped)
+		s.fwd = progress{conn: s.fwd.conn}
+		s.stats.Pending = s.size()
+		return false
+	}
+
+	log.Infof("sending connection %d again from its start", s.fwd.conn)
+	s.fwd.part = 0
+	s.fwd.bytes = 0
+	return true
+}
+
+// Records a segment as sent on the current collector connection.
+func (s *Spool) advance(name string, n int64) {
+	conn, part, _ := parseName(name)
+
+	s.Lock()
+	defer s.Unlock()
+	if conn == s.fwd.conn {
+		s.fwd.part = part + 1
+		s.fwd.bytes += n
+	}
+}
+
+// Deletes the data of a fully forwarded incoming connection.
+func (s *Spool) finish(end string) {
+	conn, _, _ := parseName(end)
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, name := range s.segments(conn) {
+		removeFile(filepath.Join(s.dir, name))
+	}
+	removeFile(filepath.Join(s.dir, end))
+
+	if conn == s.fwd.conn {
+		s.stats.Forwarded += s.fwd.bytes
+		s.fwd = progress{conn: conn}
+	}
+	s.stats.Pending = s.size()
+}
+
+// Writes a whole segment to out. Returns the number of bytes written.
+func (s *Spool) send(out net.Conn, name string) (int64, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return io.Copy(out, f)
+}
+
+// Returns the IDs of the incoming connections with data on disk, in order,
+// skipping dropped ones. Must be called with the lock held.
+func (s *Spool) connections() []uint64 {
+	seen := map[uint64]bool{}
+	conns := []uint64{}
+	for _, ext := range []string{extSegment, extTemp} {
+		for _, name := range s.list(ext) {
+			conn, _, _ := parseName(name)
+			if !seen[conn] && !s.dropped[conn] {
+				seen[conn] = true
+				conns = append(conns, conn)
+			}
+		}
+	}
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i] < conns[j]
+	})
+	return conns
+}
+
+// Returns the sorted names of the complete segments of an incoming connection.
+func (s *Spool) segments(conn uint64) []string {
+	names := []string{}
+	for _, name := range s.list(extSegment) {
+		if c, _, _ := parseName(name); c == conn {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Returns the sorted names of the files with the given extension.
+func (s *Spool) list(ext string) []string {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, "*"+ext))
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, filepath.Base(m))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the total size of the data in the spool directory.
+func (s *Spool) size() int64 {
+	var total int64
+	for _, ext := range []string{extSegment, extTemp} {
+		for _, name := range s.list(ext) {
+			if info, err := os.Stat(filepath.Join(s.dir, name)); err == nil {
+				total += info.Size()
+			}
+		}
+	}
+	return total
+}
+
+func (s *Spool) setConnected(connected bool) {
+	s.Lock()
+	s.stats.Connected = connected
+	s.Unlock()
+}
+
+// Signals the forwarder that there might be new data.
+func (s *Spool) wakeUp() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Parses a spool file name (conn-part.ext or conn.ext) into its connection and
+// part numbers.
+func parseName(name string) (uint64, uint64, bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	connStr, partStr, _ := strings.Cut(base, "-")
+
+	conn, err := strconv.ParseUint(connStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	part, _ := strconv.ParseUint(partStr, 10, 64)
+	return conn, part, true
+}
+
+// Removes a file, returning its size or -1 if it could not be removed.
+func removeFile(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	err = os.Remove(path)
+	if err != nil {
+		log.Error(err)
+		return -1
+	}
+	return info.Size()
+}
+
+// Creates an empty file.
+func touch(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,223 @@
+package spool
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Returns a free local TCP address.
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// Sends data to the spool on a new connection.
+func sendData(t *testing.T, addr string, data string) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Accepts a single connection and returns everything received on it.
+func receiveData(t *testing.T, l net.Listener) string {
+	_ = l.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSpool(t *testing.T) {
+	t.Run("collector reachable", func(t *testing.T) {
+		collector, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer collector.Close()
+
+		s, err := New("127.0.0.1:0", collector.Addr().String(), t.TempDir(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		sendData(t, s.Addr(), "measurement")
+		if got := receiveData(t, collector); got != "measurement" {
+			t.Fatalf("expected %q, got %q", "measurement", got)
+		}
+	})
+
+	t.Run("collector unreachable", func(t *testing.T) {
+		target := freeAddr(t)
+		s, err := New("127.0.0.1:0", target, t.TempDir(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		sendData(t, s.Addr(), "first")
+		sendData(t, s.Addr(), "second")
+		time.Sleep(2 * segmentTimeout)
+
+		collector, err := net.Listen("tcp", target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer collector.Close()
+
+		// Connections are forwarded separately and in order
+		if got := receiveData(t, collector); got != "first" {
+			t.Fatalf("expected %q, got %q", "first", got)
+		}
+		if got := receiveData(t, collector); got != "second" {
+			t.Fatalf("expected %q, got %q", "second", got)
+		}
+		if s.Stats().Forwarded != int64(len("firstsecond")) {
+			t.Fatalf("expected %d forwarded bytes, got %d", len("firstsecond"), s.Stats().Forwarded)
+		}
+	})
+
+	t.Run("collector connection lost", func(t *testing.T) {
+		collector, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer collector.Close()
+
+		s, err := New("127.0.0.1:0", collector.Addr().String(), t.TempDir(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		in, err := net.Dial("tcp", s.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer in.Close()
+
+		sent := ""
+		write := func(chunk string) {
+			_, err := in.Write([]byte(chunk))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sent += chunk
+		}
+
+		// The collector drops the first connection after the first segment
+		write("segment-0;")
+		_ = collector.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+		first, err := collector.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = first.Close()
+
+		// Keep sending until the spool notices and connects again
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, err := collector.Accept()
+			if err == nil {
+				accepted <- conn
+			}
+		}()
+		var second net.Conn
+		for i := 1; second == nil; i++ {
+			if i > 20 {
+				t.Fatal("spool did not reconnect")
+			}
+			time.Sleep(segmentTimeout + 100*time.Millisecond)
+			select {
+			case second = <-accepted:
+			default:
+				write(fmt.Sprintf("segment-%d;", i))
+			}
+		}
+		defer second.Close()
+		write("last;")
+		_ = in.Close()
+
+		// The new connection carries the whole stream from its start, exactly once
+		_ = second.SetDeadline(time.Now().Add(10 * time.Second))
+		got, err := io.ReadAll(second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != sent {
+			t.Fatalf("expected %q, got %q", sent, got)
+		}
+	})
+
+	t.Run("size limit drops whole connections", func(t *testing.T) {
+		target := freeAddr(t)
+		s, err := New("127.0.0.1:0", target, t.TempDir(), 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		// Two segments of the same connection, which does not fit as a whole
+		in, err := net.Dial("tcp", s.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = in.Write([]byte("aaaa"))
+		time.Sleep(2 * segmentTimeout)
+		_, _ = in.Write([]byte("bbbb"))
+		time.Sleep(2 * segmentTimeout)
+		_ = in.Close()
+
+		sendData(t, s.Addr(), "cc")
+		time.Sleep(2 * segmentTimeout)
+
+		collector, err := net.Listen("tcp", target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer collector.Close()
+
+		if got := receiveData(t, collector); got != "cc" {
+			t.Fatalf("expected %q, got %q", "cc", got)
+		}
+		if s.Stats().Dropped != 8 {
+			t.Fatalf("expected 8 dropped bytes, got %d", s.Stats().Dropped)
+		}
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		s, err := New("127.0.0.1:0", freeAddr(t), t.TempDir(), 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		sendData(t, s.Addr(), "too much data")
+		time.Sleep(2 * segmentTimeout)
+
+		if s.Stats().Dropped == 0 {
+			t.Fatal("expected data to be dropped")
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openrfsense/common/stats"
+)
+
+// Type StatsConnection reports the state of the connection to the NATS servers.
+type StatsConnection struct {
+	Connected bool `json:"connected"`
+
+	// Server the node is currently connected to, if any
+	Server string `json:"server,omitempty"`
+
+	// Known servers, including the ones discovered from the cluster
+	Servers []string `json:"servers"`
+
+	// Number of reconnections since the node started
+	Reconnects uint64 `json:"reconnects"`
+
+	// Why and when the connection was last lost, if ever
+	LastDisconnect     string     `json:"lastDisconnect,omitempty"`
+	LastDisconnectTime *time.Time `json:"lastDisconnectTime,omitempty"`
+}
+
+// Returns the state of the connection, set by the NATS client
+var connectionSource func() StatsConnection
+
+// Sets the function used to report the state of the connection to the NATS servers.
+func SetConnectionSource(source func() StatsConnection) {
+	connectionSource = source
+}
+
+// providerConnection implements stats.Provider.
+var _ stats.Provider = providerConnection{}
+
+// Stats provider for the connection to the NATS servers.
+type providerConnection struct{}
+
+func (providerConnection) Name() string {
+	return "connection"
+}
+
+func (providerConnection) Stats() (interface{}, error) {
+	if connectionSource == nil {
+		return nil, fmt.Errorf("not connected to NATS")
+	}
+
+	return connectionSource(), nil
+}
@@ -0,0 +1,21 @@
+package stats
+
+import (
+	"github.com/openrfsense/node/system"
+
+	"github.com/openrfsense/common/stats"
+)
+
+// providerSDR implements stats.Provider.
+var _ stats.Provider = providerSDR{}
+
+// Stats provider for the SDR devices attached via USB.
+type providerSDR struct{}
+
+func (providerSDR) Name() string {
+	return "sdr"
+}
+
+func (providerSDR) Stats() (interface{}, error) {
+	return system.ListSDRs()
+}
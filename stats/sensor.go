@@ -13,6 +13,15 @@ type StatsSensor struct {
 
 	// Current campaign ID (if running) or null (if free)
 	CampaignId string `json:"campaignId,omitempty"`
+
+	// IDs of the campaigns waiting to be started, in order
+	Scheduled []string `json:"scheduled,omitempty"`
+
+	// Status of every sensing device
+	Devices []sensor.DeviceStatus `json:"devices"`
+
+	// Limits applied to the sensor process
+	Process sensor.ProcessStatus `json:"process"`
 }
 
 // providerSensor implements stats.Provider.
@@ -26,8 +35,16 @@ func (providerSensor) Name() string {
 }
 
 func (providerSensor) Stats() (interface{}, error) {
+	scheduled := []string{}
+	for _, c := range sensor.Queue() {
+		scheduled = append(scheduled, c.Id)
+	}
+
 	return StatsSensor{
 		Status:     sensor.Status(),
 		CampaignId: sensor.CampaignId(),
+		Scheduled:  scheduled,
+		Devices:    sensor.Devices(),
+		Process:    sensor.Isolation(),
 	}, nil
 }
@@ -0,0 +1,28 @@
+package stats
+
+import (
+	"fmt"
+
+	"github.com/openrfsense/node/spool"
+
+	"github.com/openrfsense/common/stats"
+)
+
+// providerSpool implements stats.Provider.
+var _ stats.Provider = providerSpool{}
+
+// Stats provider for the local measurement spool.
+type providerSpool struct{}
+
+func (providerSpool) Name() string {
+	return "spool"
+}
+
+func (providerSpool) Stats() (interface{}, error) {
+	s := spool.GetStats()
+	if s == nil {
+		return nil, fmt.Errorf("measurement spool is disabled")
+	}
+
+	return *s, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/openrfsense/common/logging"
 	"github.com/openrfsense/common/stats"
+	"github.com/openrfsense/node/spool"
 	"github.com/openrfsense/node/system"
 )
 
@@ -41,11 +42,28 @@ func GetStats() (*stats.Stats, error) {
 		providerMemory{},
 		providerFs{},
 		providerNetwork{},
+		providerSDR{},
 	)
 	if err != nil {
 		log.Error(err)
 	}
 
+	// The connection is only known once the NATS client is started
+	if connectionSource != nil {
+		err = s.Provide(providerConnection{})
+		if err != nil {
+			log.Error(err)
+		}
+	}
+
+	// The spool is optional
+	if spool.GetStats() != nil {
+		err = s.Provide(providerSpool{})
+		if err != nil {
+			log.Error(err)
+		}
+	}
+
 	return s, nil
 }
 
@@ -0,0 +1,105 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const usbDevicesPath = "/sys/bus/usb/devices"
+
+// Type SDRDevice describes an SDR device attached via USB.
+type SDRDevice struct {
+	// Human-readable model, from the list of known devices
+	Model string `json:"model"`
+
+	// USB vendor and product IDs, as hex strings
+	VendorID  string `json:"vendorId"`
+	ProductID string `json:"productId"`
+
+	// Manufacturer and product strings reported by the device, if any
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+
+	Serial string `json:"serial,omitempty"`
+
+	// SysFS bus path of the device (e.g. 1-1.2)
+	BusPath string `json:"busPath"`
+}
+
+// Known SDR devices, indexed by "vendor:product" USB IDs
+var knownSDRs = map[string]string{
+	"0bda:2832": "RTL2832U",
+	"0bda:2838": "RTL2832U",
+	"1d50:6089": "HackRF One",
+	"1d50:604b": "HackRF Jawbreaker",
+	"1d50:cc15": "rad1o",
+	"1d50:60a1": "Airspy",
+	"03eb:800c": "Airspy HF+",
+	"1d50:6108": "LimeSDR",
+	"0403:601f": "LimeSDR Mini",
+	"2500:0020": "USRP B200/B210",
+	"2500:0021": "USRP B200mini",
+	"1df7:2500": "SDRplay RSP1",
+	"1df7:3000": "SDRplay RSP1A",
+	"1df7:3010": "SDRplay RSP2",
+	"1df7:3020": "SDRplay RSPduo",
+	"1df7:3030": "SDRplay RSPdx",
+	"0456:b673": "ADALM-PLUTO",
+	"04d8:fb56": "FUNcube Dongle Pro",
+	"04d8:fb31": "FUNcube Dongle Pro+",
+}
+
+// Returns the SDR devices currently attached via USB, by matching vendor and
+// product IDs found in SysFS against a list of known devices.
+func ListSDRs() ([]SDRDevice, error) {
+	return listSDRs(usbDevicesPath)
+}
+
+func listSDRs(root string) ([]SDRDevice, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []SDRDevice{}
+	for _, e := range entries {
+		// Interfaces (e.g. 1-1.2:1.0) share the IDs of their device
+		if strings.Contains(e.Name(), ":") {
+			continue
+		}
+
+		dir := filepath.Join(root, e.Name())
+		vendor := strings.ToLower(readSysfs(dir, "idVendor"))
+		product := strings.ToLower(readSysfs(dir, "idProduct"))
+		model, known := knownSDRs[vendor+":"+product]
+		if !known {
+			continue
+		}
+
+		ret = append(ret, SDRDevice{
+			Model:        model,
+			VendorID:     vendor,
+			ProductID:    product,
+			Manufacturer: readSysfs(dir, "manufacturer"),
+			Product:      readSysfs(dir, "product"),
+			Serial:       readSysfs(dir, "serial"),
+			BusPath:      e.Name(),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].BusPath < ret[j].BusPath
+	})
+	return ret, nil
+}
+
+// Reads a SysFS attribute, returning an empty string if it cannot be read.
+func readSysfs(dir string, attr string) string {
+	data, err := os.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
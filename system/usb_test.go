@@ -0,0 +1,59 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Creates a fake SysFS USB device with the given attributes.
+func fakeDevice(t *testing.T, root string, name string, attrs map[string]string) {
+	dir := filepath.Join(root, name)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for attr, value := range attrs {
+		err := os.WriteFile(filepath.Join(dir, attr), []byte(value+"\n"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestListSDRs(t *testing.T) {
+	root := t.TempDir()
+	fakeDevice(t, root, "1-1.2", map[string]string{
+		"idVendor":     "0bda",
+		"idProduct":    "2838",
+		"manufacturer": "Realtek",
+		"serial":       "00000001",
+	})
+	fakeDevice(t, root, "1-1.2:1.0", map[string]string{
+		"idVendor":  "0bda",
+		"idProduct": "2838",
+	})
+	fakeDevice(t, root, "1-1.3", map[string]string{
+		"idVendor":  "1D50",
+		"idProduct": "6089",
+	})
+	fakeDevice(t, root, "usb1", map[string]string{
+		"idVendor":  "1d6b",
+		"idProduct": "0002",
+	})
+
+	sdrs, err := listSDRs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sdrs) != 2 {
+		t.Fatalf("expected 2 devices, got %d: %v", len(sdrs), sdrs)
+	}
+	if sdrs[0].Model != "RTL2832U" || sdrs[0].Serial != "00000001" || sdrs[0].BusPath != "1-1.2" {
+		t.Fatalf("unexpected RTL-SDR description: %+v", sdrs[0])
+	}
+	if sdrs[1].Model != "HackRF One" {
+		t.Fatalf("unexpected HackRF description: %+v", sdrs[1])
+	}
+}
@@ -0,0 +1,238 @@
+var scanForm = document.getElementById("scan-form")
+var scanDuration = document.getElementById("scan-duration")
+var scanStart = document.getElementById("scan-start")
+var scanStatus = document.getElementById("scan-status")
+var scanOutput = document.getElementById("scan-output")
+var scanPlot = document.getElementById("scan-plot")
+
+// Returns the measurement request described by the scan form
+function scanRequest() {
+    var data = new FormData(scanForm)
+    return {
+        freqMin: Math.round(parseFloat(data.get("freqMin")) * 1e6),
+        freqMax: Math.round(parseFloat(data.get("freqMax")) * 1e6),
+        freqRes: Math.round(parseFloat(data.get("freqRes")) * 1e3),
+        duration: parseInt(data.get("duration")),
+        profile: data.get("profile"),
+    }
+}
+
+// Checks the scan form, allowing the longer duration of live measurements if live
+// is true (quick scans are limited by the max attribute)
+function scanFormValid(live) {
+    var max = scanDuration.max
+    if (live) {
+        scanDuration.max = scanDuration.dataset.liveMax
+    }
+    var valid = scanForm.reportValidity()
+    scanDuration.max = max
+    return valid
+}
+
+scanForm.addEventListener("submit", event => {
+    event.preventDefault()
+
+    var req = scanRequest()
+
+    scanStart.classList.toggle("disabled", true)
+    scanStatus.textContent = "Scanning for " + req.duration + " seconds..."
+
+    fetch(event.target.action, {
+        method: event.target.method,
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(req),
+    })
+        .then(res => res.ok ? res.json() : res.text().then(text => Promise.reject(new Error(text))))
+        .then(res => {
+            scanStatus.textContent = res.outcome + ": " + res.frames + " frames (" + res.bytes + " bytes) on device " + res.device
+            scanOutput.textContent = res.output.map(line => line.text).join("\n")
+            if (!res.values || res.values.length === 0) {
+                scanStatus.textContent += ", the data could not be decoded"
+            }
+            plotSpectrum(scanPlot, res.freqMin, res.freqMax, res.values || [])
+        })
+        .catch(err => {
+            scanStatus.textContent = "Scan failed: " + err.message
+        })
+        .finally(() => scanStart.classList.toggle("disabled", false))
+})
+
+// Draws the PSD values (dBm) over the frequency range (Hz) on the canvas
+function plotSpectrum(canvas, freqMin, freqMax, values) {
+    var ctx = canvas.getContext("2d")
+    var width = canvas.width = canvas.clientWidth
+    var height = canvas.height
+    var margin = { left: 50, right: 10, top: 10, bottom: 30 }
+    var plotWidth = width - margin.left - margin.right
+    var plotHeight = height - margin.top - margin.bottom
+
+    ctx.clearRect(0, 0, width, height)
+    if (values.length === 0) {
+        return
+    }
+
+    var min = Math.floor(Math.min(...values) / 10) * 10
+    var max = Math.ceil(Math.max(...values) / 10) * 10
+    if (max === min) {
+        max = min + 10
+    }
+    var x = i => margin.left + (i + 0.5) / values.length * plotWidth
+    var y = v => margin.top + (max - v) / (max - min) * plotHeight
+
+    // Axes and labels
+    ctx.strokeStyle = "#dadfe5"
+    ctx.fillStyle = "#626976"
+    ctx.font = "12px sans-serif"
+    ctx.textAlign = "right"
+    for (var v = min; v <= max; v += 10) {
+        ctx.beginPath()
+        ctx.moveTo(margin.left, y(v))
+        ctx.lineTo(width - margin.right, y(v))
+        ctx.stroke()
+        ctx.fillText(v + " dBm", margin.left - 4, y(v) + 4)
+    }
+    ctx.textAlign = "center"
+    for (var t = 0; t <= 4; t++) {
+        var freq = freqMin + (freqMax - freqMin) * t / 4
+        ctx.fillText((freq / 1e6).toFixed(3) + " MHz", margin.left + plotWidth * t / 4, height - 10)
+    }
+
+    // Spectrum
+    ctx.strokeStyle = "#206bc4"
+    ctx.beginPath()
+    values.forEach((v, i) => i === 0 ? ctx.moveTo(x(i), y(v)) : ctx.lineTo(x(i), y(v)))
+    ctx.stroke()
+}
+
+var liveStart = document.getElementById("live-start")
+var liveStop = document.getElementById("live-stop")
+var liveStatus = document.getElementById("live-status")
+var liveSpectrum = document.getElementById("live-spectrum")
+var liveWaterfall = document.getElementById("live-waterfall")
+var liveSocket = null
+
+liveStart.addEventListener("click", () => {
+    if (!scanFormValid(true)) {
+        return
+    }
+
+    var scheme = window.location.protocol === "https:" ? "wss://" : "ws://"
+    liveSocket = new WebSocket(scheme + window.location.host + "/api/sensor/live")
+    liveSocket.addEventListener("open", () => {
+        liveSocket.send(JSON.stringify(scanRequest()))
+        liveStatus.textContent = "Waiting for the first frame..."
+    })
+    liveSocket.addEventListener("message", event => {
+        var msg = JSON.parse(event.data)
+        switch (msg.type) {
+        case "frame":
+            liveStatus.textContent = "Running, last frame at " + new Date(msg.frame.time).toLocaleTimeString()
+            plotSpectrum(liveSpectrum, msg.frame.freqMin, msg.frame.freqMax, msg.frame.values)
+            addWaterfallRow(msg.frame.values)
+            break
+        case "result":
+            liveStatus.textContent = msg.result.outcome + ": " + msg.result.frames + " frames"
+            break
+        case "error":
+            liveStatus.textContent = "Failed: " + msg.error
+            break
+        }
+    })
+    liveSocket.addEventListener("close", () => {
+        liveSocket = null
+        liveStart.classList.toggle("disabled", false)
+        liveStop.classList.toggle("disabled", true)
+    })
+
+    clearWaterfall()
+    liveStart.classList.toggle("disabled", true)
+    liveStop.classList.toggle("disabled", false)
+})
+
+liveStop.addEventListener("click", () => {
+    if (liveSocket) {
+        liveSocket.close()
+        liveStatus.textContent = "Stopped"
+    }
+})
+
+function clearWaterfall() {
+    liveWaterfall.width = liveWaterfall.clientWidth
+    var ctx = liveWaterfall.getContext("2d")
+    ctx.fillStyle = "#000"
+    ctx.fillRect(0, 0, liveWaterfall.width, liveWaterfall.height)
+}
+
+// Scrolls the waterfall down by one row and draws the PSD values (dBm) on top,
+// scaling colors between the minimum and maximum of the frame
+function addWaterfallRow(values) {
+    var ctx = liveWaterfall.getContext("2d")
+    var width = liveWaterfall.width
+    var height = liveWaterfall.height
+    var rowHeight = 2
+
+    ctx.drawImage(liveWaterfall, 0, 0, width, height - rowHeight, 0, rowHeight, width, height - rowHeight)
+
+    var min = Math.min(...values)
+    var max = Math.max(...values)
+    var row = ctx.createImageData(width, rowHeight)
+    for (var x = 0; x < width; x++) {
+        var v = values[Math.floor(x / width * values.length)]
+        var color = heatColor(max > min ? (v - min) / (max - min) : 0)
+        for (var y = 0; y < rowHeight; y++) {
+            row.data.set([color[0], color[1], color[2], 255], (y * width + x) * 4)
+        }
+    }
+    ctx.putImageData(row, 0, 0)
+}
+
+// Maps a value between 0 and 1 to a color going from dark blue to yellow
+function heatColor(t) {
+    var stops = [[0, 0, 64], [32, 64, 192], [0, 192, 160], [240, 220, 40]]
+    var pos = Math.min(Math.max(t, 0), 1) * (stops.length - 1)
+    var i = Math.min(Math.floor(pos), stops.length - 2)
+    var f = pos - i
+    return stops[i].map((c, k) => Math.round(c + (stops[i + 1][k] - c) * f))
+}
+
+var eventsTable = document.getElementById("events-table")
+var eventsStatus = document.getElementById("events-status")
+var eventsShown = 50
+var eventsSource = new EventSource("/api/sensor/events")
+
+eventsSource.addEventListener("open", () => {
+    eventsStatus.textContent = "Connected"
+})
+
+eventsSource.addEventListener("error", () => {
+    eventsStatus.textContent = "Reconnecting"
+})
+
+// Adds a row to the top of the events table, keeping only the most recent ones
+function addEventRow(event) {
+    var e = JSON.parse(event.data)
+    var row = eventsTable.insertRow(0)
+    var cells = [
+        new Date(e.time).toLocaleTimeString(),
+        e.type,
+        e.campaignId,
+        e.device,
+        e.from + " → " + e.to,
+        e.reason || "",
+    ]
+    cells.forEach(text => {
+        row.insertCell().textContent = text
+    })
+    if (e.type === "FAILED") {
+        row.classList.add("text-danger")
+    }
+
+    while (eventsTable.rows.length > eventsShown) {
+        eventsTable.deleteRow(-1)
+    }
+}
+
+var eventTypes = ["ACCEPTED", "STARTED", "FINISHED", "FAILED", "CANCELLED"]
+eventTypes.forEach(type => {
+    eventsSource.addEventListener(type, addEventRow)
+})
@@ -6,6 +6,7 @@ import (
 
 	"github.com/openrfsense/common/logging"
 	"github.com/openrfsense/node/config"
+	"github.com/openrfsense/node/sensor"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
@@ -51,6 +52,7 @@ func Init(config *koanf.Koanf, router *fiber.App) {
 	)
 
 	router.Get("/", renderIndex)
+	router.Get("/scan", renderScan)
 }
 
 // Renders the main webpage for the UI.
@@ -71,3 +73,10 @@ func renderIndex(c *fiber.Ctx) error {
 		"config": config.Text(),
 	})
 }
+
+// Renders the quick scan page for the UI.
+func renderScan(c *fiber.Ctx) error {
+	return c.Render("views/scan", fiber.Map{
+		"profiles": sensor.Profiles(),
+	})
+}